@@ -1,40 +1,117 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"docker-manager/internal/api"
+	"docker-manager/internal/config"
 	"docker-manager/internal/service"
+
+	"github.com/gorilla/websocket"
 )
 
-// getPort returns the port to listen on
-func getPort() string {
-	// Priority: 1. Command line flag, 2. Environment variable, 3. Default
-	var port = flag.String("port", "", "Port to listen on (default: 8080)")
+func main() {
+	port := flag.String("port", "", "Port to listen on (default: 8080)")
+	configPath := flag.String("config", "", "Path to a YAML or JSON config file")
+	dockerHost := flag.String("docker-host", "", "Docker daemon to connect to, e.g. tcp://host:2376")
 	flag.Parse()
 
+	// Priority: 1. Command line flag, 2. Config file, 3. Environment variable, 4. Default
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
 	if *port != "" {
-		return ":" + *port
+		cfg.Port = *port
 	}
+	if *dockerHost != "" {
+		cfg.DockerHost = *dockerHost
+	}
+	service.RequestTimeout = cfg.RequestTimeout
 
-	if envPort := os.Getenv("DOCKER_MANAGER_PORT"); envPort != "" {
-		return ":" + envPort
+	if err := service.InitStopTimeout(); err != nil {
+		log.Fatal(err)
+	}
+	if err := service.InitReadCache(); err != nil {
+		log.Fatal(err)
+	}
+	if err := service.InitAllowedOrigins(cfg.AllowedOrigins, cfg.AllowAllOrigins); err != nil {
+		log.Fatal(err)
+	}
+	if err := service.InitCORSOrigins(cfg.CORS.AllowedOrigins); err != nil {
+		log.Fatal(err)
+	}
+	if err := service.InitServiceAllowlist(cfg.ServiceAllowlist); err != nil {
+		log.Fatal(err)
 	}
 
-	return ":8080"
-}
+	// Background workers run until the server shuts down
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-func main() {
 	// Initialize Docker client
-	service.InitDockerClient()
+	service.InitDockerClient(cfg)
+	service.InitRegistryAuth(cfg)
+	service.InitEnvRedaction(cfg)
+	service.StartEventHistory(ctx)
+	service.StartStatsHistory(ctx)
+	service.StartDiskHistory(ctx)
 
-	port := getPort()
-	r := api.NewRouter()
+	if err := service.InitNotes(); err != nil {
+		log.Fatal("Failed to load container notes:", err)
+	}
+	service.StartNotesCleanup(ctx, time.Hour)
 
-	fmt.Printf("Docker Manager starting on %s\n", port)
-	log.Fatal(http.ListenAndServe(port, r))
+	r := api.NewRouter(cfg)
+
+	srv := &http.Server{Addr: cfg.Addr(), Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	fmt.Printf("Docker Manager starting on %s\n", cfg.Addr())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case sig := <-signals:
+		log.Printf("Received %s, shutting down", sig)
+		shutdown(srv, websocket.CloseGoingAway, "server shutting down")
+		cancel()
+		service.CloseDockerClients()
+	case <-api.RestartRequests():
+		log.Println("Restart requested, draining connections")
+		shutdown(srv, websocket.CloseServiceRestart, "reconnecting")
+		cancel()
+		service.CloseDockerClients()
+
+		if err := restart(); err != nil {
+			log.Fatal("Failed to restart: ", err)
+		}
+	}
+}
+
+// shutdownTimeout bounds how long in-flight requests may take to finish
+const shutdownTimeout = 30 * time.Second
+
+// shutdown closes WebSockets with the given close code and waits for
+// in-flight requests to finish
+func shutdown(srv *http.Server, closeCode int, closeText string) {
+	api.CloseWebSockets(closeCode, closeText)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println("Shutdown error:", err)
+	}
 }
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// restart is not supported without exec; rely on a supervisor to start the
+// process again after it exits
+func restart() error {
+	return errors.New("re-exec is not supported on this platform, exiting so the supervisor can restart the process")
+}
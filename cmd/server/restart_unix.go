@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// restart replaces the running process with a fresh copy of the same binary,
+// keeping the PID so supervisors like systemd keep tracking it
+func restart() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(executable, os.Args, os.Environ())
+}
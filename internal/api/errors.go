@@ -0,0 +1,42 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"syscall"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// writeDockerError writes an error returned by the Docker client with the
+// status code matching its kind, so a missing container is a 404 rather than
+// a 500
+func writeDockerError(w http.ResponseWriter, err error) {
+	status := dockerErrorStatus(err)
+	if status == http.StatusServiceUnavailable {
+		http.Error(w, "Docker daemon unavailable: "+err.Error(), status)
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// daemonUnavailable reports whether err means the daemon couldn't be reached
+func daemonUnavailable(err error) bool {
+	return client.IsErrConnectionFailed(err) || errdefs.IsUnavailable(err) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+func dockerErrorStatus(err error) int {
+	switch {
+	case daemonUnavailable(err):
+		return http.StatusServiceUnavailable
+	case errdefs.IsNotFound(err):
+		return http.StatusNotFound
+	case errdefs.IsConflict(err):
+		return http.StatusConflict
+	case errdefs.IsForbidden(err):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
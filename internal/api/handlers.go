@@ -2,17 +2,28 @@ package api
 
 import (
 	"context"
+	"docker-manager/internal/models"
 	"docker-manager/internal/service"
 	"docker-manager/internal/web"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
-	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 )
 
 func ServeIndex(w http.ResponseWriter, r *http.Request) {
@@ -25,198 +36,1716 @@ func ServeIndex(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
+func GetHosts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(service.ListHosts())
+}
+
 func GetDockerInfo(w http.ResponseWriter, r *http.Request) {
-	info, err := service.GetDockerInfo()
+	info, err := service.GetDockerInfo(r.Context())
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// containerFilterKeys are the query parameters passed through to Docker as
+// container list filters. Each may be repeated, e.g. ?label=app=web&label=tier.
+var containerFilterKeys = []string{"status", "name", "label", "ancestor", "network"}
+
+// containerStatuses are the values Docker accepts for the status filter
+var containerStatuses = map[string]bool{
+	"created":    true,
+	"restarting": true,
+	"running":    true,
+	"removing":   true,
+	"paused":     true,
+	"exited":     true,
+	"dead":       true,
+}
+
+// containerFilters builds Docker list filters from the query parameters of
+// the containers endpoint
+func containerFilters(r *http.Request) (filters.Args, error) {
+	args := filters.NewArgs()
+	query := r.URL.Query()
+	for _, key := range containerFilterKeys {
+		for _, value := range query[key] {
+			if value == "" {
+				continue
+			}
+			if key == "status" && !containerStatuses[value] {
+				return args, fmt.Errorf("invalid status %q", value)
+			}
+			args.Add(key, value)
+		}
+	}
+	return args, nil
+}
+
+func GetContainers(w http.ResponseWriter, r *http.Request) {
+	args, err := containerFilters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := parsePage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("details") == "true" {
+		containers, err := service.GetContainerSummaries(r.Context(), args)
+		if err != nil {
+			writeDockerError(w, err)
+			return
+		}
+
+		writeList(w, page, containers)
+		return
+	}
+
+	containers, err := service.ListContainers(r.Context(), args)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+	writeList(w, page, containers)
+}
+
+func GetAllContainerStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := service.GetAllContainerStats(r.Context())
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func GetOrphanedContainers(w http.ResponseWriter, r *http.Request) {
+	containers, err := service.GetOrphanedContainers(r.Context())
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(containers)
+}
+
+func GetContainerDetail(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	rawEnv, ok := rawEnvAllowed(w, r)
+	if !ok {
+		return
+	}
+
+	detail, err := service.GetContainerDetail(r.Context(), containerID, rawEnv)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+func GetContainerUsage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	usage, err := service.GetContainerUsage(r.Context(), containerID)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
+
+// defaultStatsWindow is the window used by the stats summary when none is given
+const defaultStatsWindow = 5 * time.Minute
+
+func GetContainerStatsSummary(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	window := defaultStatsWindow
+	if value := r.URL.Query().Get("window"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 || parsed > service.StatsHistoryRetention {
+			http.Error(w, fmt.Sprintf("Invalid window: must be a duration up to %s", service.StatsHistoryRetention), http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+
+	summary, err := service.GetContainerStatsSummary(r.Context(), containerID, window)
+	if errors.Is(err, service.ErrInsufficientStatsHistory) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+func GetContainerStatsHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	window := service.StatsHistoryRetention
+	if value := r.URL.Query().Get("window"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 || parsed > service.StatsHistoryRetention {
+			http.Error(w, fmt.Sprintf("Invalid window: must be a duration up to %s", service.StatsHistoryRetention), http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+
+	history, err := service.GetContainerStatsHistory(r.Context(), containerID, window)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+func StreamContainerStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	// One JSON object per line, flushed as soon as it's available
+	encoder := json.NewEncoder(&flushWriter{w: w})
+	started := false
+	err := service.StreamContainerStats(r.Context(), containerID, func(sample models.ContainerStatsSample) error {
+		if !started {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Transfer-Encoding", "chunked")
+			started = true
+		}
+		return encoder.Encode(sample)
+	})
+	if err != nil && !started {
+		writeDockerError(w, err)
+		return
+	}
+	if err != nil && r.Context().Err() == nil {
+		log.Println("Container stats stream error:", err)
+	}
+}
+
+func GetContainerPorts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	ports, err := service.GetContainerPorts(r.Context(), containerID)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ports)
+}
+
+func GetContainerMounts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	mounts, err := service.GetContainerMounts(r.Context(), containerID)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mounts)
+}
+
+func GetContainerComposeFile(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	files, err := service.GetContainerComposeFiles(r.Context(), containerID)
+	if errors.Is(err, service.ErrNotComposeManaged) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrComposeFileForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+func GetComposeProjects(w http.ResponseWriter, r *http.Request) {
+	projects, err := service.GetComposeProjects(r.Context())
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(projects)
+}
+
+func ComposeProjectUp(w http.ResponseWriter, r *http.Request) {
+	writeComposeAction(w, r, service.ComposeProjectUp)
+}
+
+func ComposeProjectDown(w http.ResponseWriter, r *http.Request) {
+	writeComposeAction(w, r, func(ctx context.Context, project string) ([]models.ContainerActionResult, error) {
+		return service.ComposeProjectDown(ctx, project, dryRun(r))
+	})
+}
+
+func writeComposeAction(w http.ResponseWriter, r *http.Request, action func(context.Context, string) ([]models.ContainerActionResult, error)) {
+	vars := mux.Vars(r)
+	project := vars["name"]
+
+	results, err := action(r.Context(), project)
+	if errors.Is(err, service.ErrComposeProjectNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+func GetComposeProjectStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["name"]
+
+	stats, err := service.GetComposeProjectStats(r.Context(), project)
+	if errors.Is(err, service.ErrComposeProjectNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// maxComposeBody is how much of a compose file upload is read. Anything over
+// the service's own limit is rejected there.
+const maxComposeBody = 1<<20 + 1
+
+func ValidateComposeFile(w http.ResponseWriter, r *http.Request) {
+	content, err := io.ReadAll(io.LimitReader(r.Body, maxComposeBody))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	validation, err := service.ValidateComposeFile(r.Context(), content)
+	if errors.Is(err, service.ErrComposeFileTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(validation)
+}
+
+func GetContainerIOLimits(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	limits, err := service.GetContainerIOLimits(r.Context(), containerID)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limits)
+}
+
+func UpdateContainerIOLimits(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	var limits models.ContainerIOLimits
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	updated, err := service.UpdateContainerIOLimits(r.Context(), containerID, limits)
+	if errors.Is(err, service.ErrInvalidBlkioWeight) || errors.Is(err, service.ErrDeviceLimitsImmutable) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+const (
+	defaultWaitTimeout = 30
+	maxWaitTimeout     = 300
+)
+
+// writeContainerAction writes the response to a lifecycle action. With
+// wait=true it first waits for the container to reach target and reports
+// the final state, so the caller doesn't need to poll.
+func writeContainerAction(w http.ResponseWriter, r *http.Request, containerID, status, target string) {
+	response := map[string]string{"status": status}
+
+	if r.URL.Query().Get("wait") == "true" {
+		timeout := defaultWaitTimeout
+		if value, err := strconv.Atoi(r.URL.Query().Get("wait_timeout")); err == nil && value > 0 {
+			timeout = value
+		}
+		if timeout > maxWaitTimeout {
+			timeout = maxWaitTimeout
+		}
+
+		state, err := service.WaitForContainerState(r.Context(), containerID, target, time.Duration(timeout)*time.Second)
+		if state != nil {
+			response["state"] = state.Status
+		}
+		if err != nil {
+			response["error"] = err.Error()
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func SetContainerNote(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	var note models.ContainerNote
+	if err := json.NewDecoder(r.Body).Decode(&note); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	saved, err := service.SetContainerNote(r.Context(), containerID, note)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+func GetContainerClock(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	clock, err := service.GetContainerClock(r.Context(), containerID)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clock)
+}
+
+func GetContainerNamespaces(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	namespaces, err := service.GetContainerNamespaces(r.Context(), containerID)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(namespaces)
+}
+
+func GetContainerInspectRaw(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	rawEnv, ok := rawEnvAllowed(w, r)
+	if !ok {
+		return
+	}
+
+	raw, err := service.GetContainerInspectRaw(r.Context(), containerID, rawEnv)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(raw)
+}
+
+func GetContainerHealth(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	health, err := service.GetContainerHealth(r.Context(), containerID)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(health)
+}
+
+func GetContainerChanges(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	changes, err := service.GetContainerChanges(r.Context(), containerID)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
+func GetContainerTop(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	top, err := service.GetContainerTop(r.Context(), containerID, r.URL.Query().Get("ps_args"))
+	if errors.Is(err, service.ErrContainerNotRunning) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(top)
+}
+
+func CreateContainer(w http.ResponseWriter, r *http.Request) {
+	var req models.ContainerCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	result, err := service.CreateContainer(r.Context(), req)
+	if errors.Is(err, service.ErrInvalidContainerSpec) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, service.ErrImageNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
+
+func UpdateContainer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	var req models.ContainerUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	result, err := service.UpdateContainer(r.Context(), containerID, req)
+	if errors.Is(err, service.ErrInvalidContainerSpec) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func StartContainer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	err := service.StartContainer(r.Context(), containerID)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	writeContainerAction(w, r, containerID, "started", "running")
+}
+
+func PauseContainer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	err := service.PauseContainer(r.Context(), containerID)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	writeContainerAction(w, r, containerID, "paused", "paused")
+}
+
+func UnpauseContainer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	err := service.UnpauseContainer(r.Context(), containerID)
+	if errors.Is(err, service.ErrContainerNotPaused) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	writeContainerAction(w, r, containerID, "unpaused", "running")
+}
+
+// stopTimeout reads the optional t query parameter overriding the default
+// number of seconds to wait before a container is killed
+func stopTimeout(r *http.Request) (*int, error) {
+	value := r.URL.Query().Get("t")
+	if value == "" {
+		return nil, nil
+	}
+
+	timeout, err := strconv.Atoi(value)
+	if err != nil || timeout < 0 {
+		return nil, fmt.Errorf("t must be a non-negative integer")
+	}
+	return &timeout, nil
+}
+
+func StopContainer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	timeout, err := stopTimeout(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = service.StopContainer(r.Context(), containerID, timeout)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	writeContainerAction(w, r, containerID, "stopped", "exited")
+}
+
+func RestartContainer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	timeout, err := stopTimeout(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = service.RestartContainer(r.Context(), containerID, timeout)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	writeContainerAction(w, r, containerID, "restarted", "running")
+}
+
+func SnapshotContainer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	filename := fmt.Sprintf("snapshot-%s-%s.zip", containerID, time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	snapshot, err := service.SnapshotContainer(r.Context(), containerID, w)
+	if err != nil {
+		w.Header().Del("Content-Disposition")
+		writeDockerError(w, err)
+		return
+	}
+
+	if snapshot.RestartError != "" {
+		log.Printf("Snapshot of %s: failed to restart container: %s", containerID, snapshot.RestartError)
+	}
+}
+
+func DownloadContainerFile(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	filePath := r.URL.Query().Get("path")
+	if filePath == "" {
+		http.Error(w, "path is required", http.StatusBadRequest)
+		return
+	}
+
+	file, err := service.OpenContainerFile(r.Context(), containerID, filePath)
+	if errors.Is(err, service.ErrNotAFile) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Name))
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+
+	if _, err := io.Copy(w, file); err != nil && r.Context().Err() == nil {
+		log.Printf("Download of %s from %s failed: %v", filePath, containerID, err)
+	}
+}
+
+// maxUploadBytes bounds files uploaded into containers, which are held in
+// memory while they are archived
+const maxUploadBytes = 32 << 20
+
+func UploadContainerFile(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	query := r.URL.Query()
+	dir := query.Get("path")
+	if dir == "" {
+		http.Error(w, "path is required", http.StatusBadRequest)
+		return
+	}
+
+	file := service.FileUpload{
+		Name:       query.Get("name"),
+		CopyUIDGID: query.Get("copy_uid_gid") == "true",
+	}
+	for key, id := range map[string]*int{"uid": &file.UID, "gid": &file.GID} {
+		if value := query.Get(key); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				http.Error(w, key+" must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+			*id = parsed
+		}
+	}
+
+	// The file is either the raw body, named by ?name=, or the "file" part
+	// of a multipart form
+	body := io.Reader(r.Body)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		part, err := multipartFile(r, "file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if file.Name == "" {
+			file.Name = part.FileName()
+		}
+		body = part
+	}
+
+	content, err := io.ReadAll(io.LimitReader(body, maxUploadBytes+1))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read upload: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(content) > maxUploadBytes {
+		http.Error(w, fmt.Sprintf("file is larger than %d bytes", maxUploadBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+	file.Content = content
+
+	err = service.UploadContainerFile(r.Context(), containerID, dir, file)
+	if errors.Is(err, service.ErrInvalidFileName) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "uploaded", "path": path.Join(dir, file.Name)})
+}
+
+func ExportContainer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	name, reader, err := service.ExportContainer(r.Context(), containerID)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+	defer reader.Close()
+
+	filename := fmt.Sprintf("%s-%s.tar", name, time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if _, err := io.Copy(&flushWriter{w: w}, reader); err != nil && r.Context().Err() == nil {
+		log.Printf("Export of %s failed: %v", containerID, err)
+	}
+}
+
+const (
+	defaultRollingRestartTimeout = 60
+	maxRollingRestartTimeout     = 600
+)
+
+func RollingRestartContainers(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Prefix  string `json:"prefix"`
+		Label   string `json:"label"`
+		Timeout int    `json:"timeout"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Prefix == "" && req.Label == "" {
+		http.Error(w, "prefix or label is required", http.StatusBadRequest)
+		return
+	}
+
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = defaultRollingRestartTimeout
+	}
+	if timeout > maxRollingRestartTimeout {
+		timeout = maxRollingRestartTimeout
+	}
+
+	result, err := service.RollingRestart(r.Context(), req.Prefix, req.Label, time.Duration(timeout)*time.Second)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func RemoveContainer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	force := r.URL.Query().Get("force") == "true"
+	removeVolumes := r.URL.Query().Get("v") == "true"
+
+	preview := dryRun(r)
+
+	err := service.RemoveContainer(r.Context(), containerID, force, removeVolumes, preview)
+	if errors.Is(err, service.ErrContainerRunning) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	status := "removed"
+	if preview {
+		status = "dry_run"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
+// dryRun reports whether a destructive request should only list what it
+// would act on
+func dryRun(r *http.Request) bool {
+	return r.URL.Query().Get("dry_run") == "true"
+}
+
+func RemoveContainers(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs     []string `json:"ids"`
+		Force   bool     `json:"force"`
+		Volumes bool     `json:"volumes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) == 0 {
+		http.Error(w, "ids is required", http.StatusBadRequest)
+		return
+	}
+
+	results, err := service.RemoveContainers(r.Context(), req.IDs, req.Force, req.Volumes, dryRun(r))
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+func PruneContainers(w http.ResponseWriter, r *http.Request) {
+	results, err := service.PruneContainers(r.Context(), dryRun(r))
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+func StopContainersByLabel(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Label string `json:"label"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	// An empty selector would match every running container
+	if strings.TrimSpace(req.Label) == "" {
+		http.Error(w, "label is required", http.StatusBadRequest)
+		return
+	}
+
+	results, err := service.StopContainersByLabel(r.Context(), req.Label, dryRun(r))
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+func GetContainerLogs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	tail := r.URL.Query().Get("tail")
+	if tail == "" {
+		tail = "100"
+	}
+
+	// Lines are filtered after demultiplexing so stream headers never match
+	var match func(string) bool
+	if grep := r.URL.Query().Get("grep"); grep != "" {
+		var err error
+		match, err = service.LogLineMatcher(grep, r.URL.Query().Get("regex") == "true")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w, err := throttleResponse(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	options := types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       tail,
+		Timestamps: true,
+	}
+
+	logs, err := service.OpenContainerLogs(ctx, containerID, options)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+	defer logs.Close()
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Transfer-Encoding", "chunked")
+
+	// With streams=true every line is prefixed with the stream it came from
+	streams := r.URL.Query().Get("streams") == "true"
+	if streams || match != nil {
+		err = logs.EmitLines(func(line models.LogLine) error {
+			if match != nil && !match(line.Line) {
+				return nil
+			}
+			if streams {
+				_, err := fmt.Fprintf(w, "[%s] %s\n", line.Stream, line.Line)
+				return err
+			}
+			_, err := fmt.Fprintln(w, line.Line)
+			return err
+		})
+	} else {
+		err = logs.Copy(w)
+	}
+	if err != nil {
+		log.Println("Container logs error:", err)
+	}
+}
+
+const (
+	defaultBundleTail = 500
+	maxBundleTail     = 5000
+	maxBundleBytes    = 100 << 20
+)
+
+func StreamContainerLogs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	tail := r.URL.Query().Get("tail")
+	if tail == "" {
+		tail = "100"
+	}
+
+	conn, err := service.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("WebSocket upgrade error:", err)
+		return
+	}
+	defer conn.Close()
+	trackWebSocket(conn)
+	defer untrackWebSocket(conn)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// Stop following as soon as the client goes away
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	err = service.FollowContainerLogs(ctx, containerID, tail, func(line models.LogLine) error {
+		return conn.WriteJSON(line)
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Println("Container log stream error:", err)
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, err.Error()))
+	}
+}
+
+// terminalMessage is a control message sent by the browser terminal as a
+// text frame. Binary frames are passed to the terminal as raw input.
+type terminalMessage struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+	Rows uint   `json:"rows"`
+	Cols uint   `json:"cols"`
+}
+
+func ExecTerminal(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	containerID := vars["id"]
+
+	var cmd []string
+	if value := r.URL.Query().Get("cmd"); value != "" {
+		cmd = strings.Fields(value)
+	}
+
+	conn, err := service.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("WebSocket upgrade error:", err)
+		return
+	}
+	defer conn.Close()
+	trackWebSocket(conn)
+	defer untrackWebSocket(conn)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	session, err := service.StartExecSession(ctx, containerID, cmd)
+	if err != nil {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, err.Error()))
+		return
+	}
+	defer session.Close()
+
+	// Terminal output to the browser, until the command exits
+	go func() {
+		defer cancel()
+		buffer := make([]byte, 4096)
+		for {
+			n, err := session.Read(buffer)
+			if n > 0 {
+				if err := conn.WriteMessage(websocket.BinaryMessage, buffer[:n]); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "process exited"))
+				return
+			}
+		}
+	}()
+
+	// Browser input and control messages to the terminal
+	go func() {
+		defer cancel()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if messageType == websocket.BinaryMessage {
+				if _, err := session.Write(data); err != nil {
+					return
+				}
+				continue
+			}
+
+			var message terminalMessage
+			if err := json.Unmarshal(data, &message); err != nil {
+				continue
+			}
+			switch message.Type {
+			case "input":
+				if _, err := session.Write([]byte(message.Data)); err != nil {
+					return
+				}
+			case "resize":
+				if message.Rows > 0 && message.Cols > 0 {
+					if err := session.Resize(ctx, message.Rows, message.Cols); err != nil {
+						log.Println("Terminal resize error:", err)
+					}
+				}
+			}
+		}
+	}()
+
+	<-ctx.Done()
+}
+
+func GetContainerLogsBundle(w http.ResponseWriter, r *http.Request) {
+	tail := defaultBundleTail
+	if value := r.URL.Query().Get("tail"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			http.Error(w, "tail must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		tail = parsed
+	}
+	if tail > maxBundleTail {
+		tail = maxBundleTail
+	}
+
+	filename := fmt.Sprintf("container-logs-%s.zip", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if err := service.WriteLogsBundle(r.Context(), w, strconv.Itoa(tail), maxBundleBytes); err != nil {
+		log.Println("Logs bundle error:", err)
+	}
+}
+
+func GetContainerLogSizes(w http.ResponseWriter, r *http.Request) {
+	sizes, err := service.GetContainerLogSizes(r.Context())
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sizes)
+}
+
+func GetImages(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("details") == "true" {
+		images, err := service.GetImageDetails(r.Context())
+		if err != nil {
+			writeDockerError(w, err)
+			return
+		}
+
+		writeList(w, page, images)
+		return
+	}
+
+	images, err := service.ListImages(r.Context())
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	writeList(w, page, images)
+}
+
+func GetImageDigests(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	imageID := vars["id"]
+
+	digests, err := service.GetImageDigests(r.Context(), imageID, r.Header.Get("X-Registry-Auth"))
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(digests)
+}
+
+const (
+	defaultSearchLimit = 25
+	maxSearchLimit     = 100
+)
+
+func SearchRegistry(w http.ResponseWriter, r *http.Request) {
+	term := r.URL.Query().Get("term")
+	if term == "" {
+		http.Error(w, "term is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	// Private registries take the same base64 auth config as the Docker API
+	registryAuth := r.Header.Get("X-Registry-Auth")
+
+	results, err := service.SearchImages(r.Context(), term, limit, registryAuth)
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// maxBatchPull bounds the number of images in a single batch pull
+const maxBatchPull = 50
+
+func PullImages(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Images   []string `json:"images"`
+		Platform string   `json:"platform"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Platform == "" {
+		req.Platform = r.URL.Query().Get("platform")
+	}
+	if err := service.ValidatePlatform(req.Platform); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var images []string
+	for _, image := range req.Images {
+		if image = strings.TrimSpace(image); image != "" {
+			images = append(images, image)
+		}
+	}
+	if len(images) == 0 {
+		http.Error(w, "images is required", http.StatusBadRequest)
+		return
+	}
+	if len(images) > maxBatchPull {
+		http.Error(w, fmt.Sprintf("at most %d images can be pulled at once", maxBatchPull), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Transfer-Encoding", "chunked")
+
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+
+	results := service.PullImages(r.Context(), images, req.Platform, func(event models.PullEvent) {
+		encoder.Encode(event)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+
+	encoder.Encode(map[string]interface{}{"results": results})
+}
+
+func BuildImage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	tags := query["t"]
+
+	// The tar build context is either the raw body or the "context" part of
+	// a multipart form
+	buildContext := io.Reader(r.Body)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		part, err := multipartFile(r, "context")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		buildContext = part
+	}
+
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	started := false
+
+	imageID, err := service.BuildImage(r.Context(), buildContext, tags, query.Get("dockerfile"), func(msg *jsonmessage.JSONMessage) {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			started = true
+		}
+		encoder.Encode(msg)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+
+	var buildErr *service.BuildError
+	if err != nil && !started && !errors.As(err, &buildErr) {
+		writeDockerError(w, err)
+		return
+	}
+	if !started {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+
+	// The daemon's messages are followed by the outcome of the build
+	result := models.ImageBuildResult{Status: "done", ImageID: imageID, Tags: tags}
+	if err != nil {
+		result = models.ImageBuildResult{Status: "failed", Error: err.Error()}
+		if errors.As(err, &buildErr) {
+			result.Step = buildErr.Step
+			result.Error = buildErr.Message
+		}
+	}
+	encoder.Encode(result)
+}
+
+// multipartFile returns the part of a multipart request body with the given
+// form name, streaming it rather than buffering the whole form
+func multipartFile(r *http.Request, name string) (*multipart.Part, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("multipart body has no %q part", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == name {
+			return part, nil
+		}
+	}
+}
+
+func RemoveImage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	imageID := vars["id"]
+
+	force := r.URL.Query().Get("force") == "true"
+	// Untagged parent images are removed too unless asked not to, as with docker rmi
+	pruneChildren := r.URL.Query().Get("prune_children") != "false"
+
+	deleted, err := service.RemoveImage(r.Context(), imageID, force, pruneChildren, dryRun(r))
+	if errors.Is(err, service.ErrImageInUse) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeDockerError(w, err)
 		return
 	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(info)
+	json.NewEncoder(w).Encode(deleted)
 }
 
-func GetContainers(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	containers, err := service.DockerClient.ContainerList(ctx, types.ContainerListOptions{All: true})
+func GetNetworks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := service.WithTimeout(r.Context())
+	defer cancel()
+	networks, err := service.DockerClient(ctx).NetworkList(ctx, types.NetworkListOptions{})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeDockerError(w, err)
 		return
 	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(containers)
+	json.NewEncoder(w).Encode(networks)
 }
 
-func GetContainerDetail(w http.ResponseWriter, r *http.Request) {
+func GetNetwork(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	containerID := vars["id"]
+	networkID := vars["id"]
 
-	detail, err := service.GetContainerDetail(containerID)
+	network, err := service.GetNetwork(r.Context(), networkID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeDockerError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(detail)
+	json.NewEncoder(w).Encode(network)
 }
 
-func StartContainer(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	containerID := vars["id"]
-
-	err := service.StartContainer(containerID)
+func GetVolumes(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := service.WithTimeout(r.Context())
+	defer cancel()
+	volumes, err := service.DockerClient(ctx).VolumeList(ctx, volume.ListOptions{})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeDockerError(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "started"})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(volumes)
 }
 
-func StopContainer(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	containerID := vars["id"]
+func PruneVolumes(w http.ResponseWriter, r *http.Request) {
+	// Volumes hold data, so pruning has to be asked for explicitly. A dry
+	// run deletes nothing and needs no confirmation.
+	preview := dryRun(r)
+	if !preview && r.URL.Query().Get("confirm") != "true" {
+		http.Error(w, "pruning volumes deletes their data, pass confirm=true to proceed", http.StatusBadRequest)
+		return
+	}
 
-	err := service.StopContainer(containerID)
+	result, err := service.PruneVolumes(r.Context(), r.URL.Query().Get("label"), preview)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeDockerError(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "stopped"})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
 }
 
-func RestartContainer(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	containerID := vars["id"]
+func GetVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(service.GetVersionInfo(r.Context()))
+}
 
-	err := service.RestartContainer(containerID)
+func GetSystemStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := service.GetSystemStats(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeDockerError(w, err)
 		return
 	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "restarted"})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
 }
 
-func GetContainerLogs(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	containerID := vars["id"]
-
-	tail := r.URL.Query().Get("tail")
-	if tail == "" {
-		tail = "100"
-	}
-
-	ctx := context.Background()
-	options := types.ContainerLogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-		Tail:       tail,
-		Timestamps: true,
-	}
-
-	logs, err := service.DockerClient.ContainerLogs(ctx, containerID, options)
+func GetRegistryConfig(w http.ResponseWriter, r *http.Request) {
+	config, err := service.GetRegistryConfig(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeDockerError(w, err)
 		return
 	}
-	defer logs.Close()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config)
+}
 
-	w.Header().Set("Content-Type", "text/plain")
-	w.Header().Set("Transfer-Encoding", "chunked")
+const (
+	defaultTimelineDays = 7
+	maxTimelineDays     = 365
+)
 
-	buffer := make([]byte, 4096)
-	for {
-		n, err := logs.Read(buffer)
-		if err != nil {
-			break
+func GetTimeline(w http.ResponseWriter, r *http.Request) {
+	days := defaultTimelineDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			http.Error(w, "days must be a positive integer", http.StatusBadRequest)
+			return
 		}
-		w.Write(buffer[:n])
+		days = parsed
+	}
+	if days > maxTimelineDays {
+		days = maxTimelineDays
 	}
-}
 
-func GetImages(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	images, err := service.DockerClient.ImageList(ctx, types.ImageListOptions{All: true})
+	timeline, err := service.GetTimeline(r.Context(), time.Duration(days)*24*time.Hour)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeDockerError(w, err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(timeline)
+}
 
+func GetCacheStats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(images)
+	json.NewEncoder(w).Encode(service.GetCacheStats())
 }
 
-func GetNetworks(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	networks, err := service.DockerClient.NetworkList(ctx, types.NetworkListOptions{})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+func GetSystemEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	since := r.URL.Query().Get("since")
+	until := r.URL.Query().Get("until")
+
+	err := service.StreamSystemEvents(ctx, since, until, eventFilter(r), w)
+	if errors.Is(err, service.ErrInvalidEventFilter) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(networks)
+// eventFilter reads the type, container and event query parameters, each of
+// which may be repeated or comma-separated
+func eventFilter(r *http.Request) service.EventFilter {
+	query := r.URL.Query()
+	values := func(key string) []string {
+		var result []string
+		for _, value := range query[key] {
+			for _, part := range strings.Split(value, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					result = append(result, part)
+				}
+			}
+		}
+		return result
+	}
+	return service.EventFilter{
+		Types:      values("type"),
+		Containers: values("container"),
+		Events:     values("event"),
+	}
 }
 
-func GetVolumes(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	volumes, err := service.DockerClient.VolumeList(ctx, volume.ListOptions{})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+func StreamSystemEventsSSE(w http.ResponseWriter, r *http.Request) {
+	filter := eventFilter(r)
+	if err := filter.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(volumes)
-}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Ask nginx not to buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
 
-func GetSystemStats(w http.ResponseWriter, r *http.Request) {
-	stats, err := service.GetSystemStats()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	out := &flushWriter{w: w}
+	// Send the headers right away so the client knows the stream is open
+	out.Write([]byte(": connected\n\n"))
+
+	err := service.WatchSystemEvents(r.Context(), r.URL.Query().Get("since"), r.URL.Query().Get("until"), filter, func(event events.Message) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "data: %s\n\n", data)
+		return err
+	})
+	if err != nil && r.Context().Err() == nil {
+		log.Println("SSE event stream error:", err)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(stats)
 }
 
-func GetSystemEvents(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	since := r.URL.Query().Get("since")
-	until := r.URL.Query().Get("until")
+const (
+	defaultPollWait = 25
+	maxPollWait     = 60
+)
 
-	err := service.StreamSystemEvents(ctx, since, until, w)
-	if err != nil {
-		return
+func PollSystemEvents(w http.ResponseWriter, r *http.Request) {
+	var cursor int64
+	if since := r.URL.Query().Get("since"); since != "" {
+		parsed, err := strconv.ParseInt(since, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "since must be a cursor returned by a previous poll", http.StatusBadRequest)
+			return
+		}
+		cursor = parsed
+	}
+
+	wait := defaultPollWait
+	if value, err := strconv.Atoi(r.URL.Query().Get("wait")); err == nil && value >= 0 {
+		wait = value
 	}
+	if wait > maxPollWait {
+		wait = maxPollWait
+	}
+
+	events, next := service.PollEvents(r.Context(), cursor, time.Duration(wait)*time.Second)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.EventPoll{Events: events, Cursor: next})
 }
 
+const (
+	defaultWSStatsInterval = 5
+	maxWSStatsInterval     = 300
+)
+
 func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// System stats are pushed every stats_interval seconds, 0 turns them off
+	statsInterval := defaultWSStatsInterval
+	if value := r.URL.Query().Get("stats_interval"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, "stats_interval must be a non-negative number of seconds", http.StatusBadRequest)
+			return
+		}
+		statsInterval = parsed
+	}
+	if statsInterval > maxWSStatsInterval {
+		statsInterval = maxWSStatsInterval
+	}
+
 	conn, err := service.Upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("WebSocket upgrade error:", err)
 		return
 	}
 	defer conn.Close()
+	trackWebSocket(conn)
+	defer untrackWebSocket(conn)
+
+	// Events caused by the manager's own batch operations are tagged with
+	// service.BatchAttribute, or dropped when the client asks to hide them
+	hideBatch := r.URL.Query().Get("hide_batch") == "true"
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// Notice clients that go away even though they never send anything,
+	// including ones that silently stop answering pings
+	expectPongs(conn)
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Every client of a host shares one Docker event subscription; the
+	// request context carries the host selected with ?host=
+	events, unsubscribe := service.SubscribeEvents(ctx)
+	defer unsubscribe()
 
-	ctx := context.Background()
-	events, errs := service.DockerClient.Events(ctx, types.EventsOptions{})
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	var statsTick <-chan time.Time
+	if statsInterval > 0 {
+		ticker := time.NewTicker(time.Duration(statsInterval) * time.Second)
+		defer ticker.Stop()
+		statsTick = ticker.C
+	}
 
 	for {
 		select {
-		case event := <-events:
-			if err := conn.WriteJSON(event); err != nil {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if service.TagBatchEvent(&event) && hideBatch {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteJSON(models.WebSocketMessage{Type: "event", Data: event}); err != nil {
 				log.Println("WebSocket write error:", err)
 				return
 			}
-		case err := <-errs:
+		case <-statsTick:
+			stats, err := service.GetSystemStats(ctx)
 			if err != nil {
-				log.Println("Docker events error:", err)
+				log.Println("WebSocket stats error:", err)
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteJSON(models.WebSocketMessage{Type: "stats", Data: stats}); err != nil {
+				log.Println("WebSocket write error:", err)
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
 				return
 			}
 		case <-ctx.Done():
@@ -225,8 +1754,65 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func HandleContainerStatsWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := service.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("WebSocket upgrade error:", err)
+		return
+	}
+	defer conn.Close()
+	trackWebSocket(conn)
+	defer untrackWebSocket(conn)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// Stop streaming as soon as the client goes away
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	err = service.StreamAllContainerStats(ctx, service.StatsBroadcastInterval, func(samples []models.ContainerStatsSample) error {
+		return conn.WriteJSON(samples)
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Println("Container stats stream error:", err)
+	}
+}
+
+func GetDiskForecast(w http.ResponseWriter, r *http.Request) {
+	forecasts, err := service.GetDiskForecast(r.Context())
+	if errors.Is(err, service.ErrPrimaryHostOnly) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(forecasts)
+}
+
+func GetBindMounts(w http.ResponseWriter, r *http.Request) {
+	mounts, err := service.GetBindMounts(r.Context())
+	if err != nil {
+		writeDockerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mounts)
+}
+
 func GetHostSystemInfo(w http.ResponseWriter, r *http.Request) {
-	hostInfo, err := service.GetHostSystemInfo()
+	hostInfo, err := service.GetHostSystemInfo(r.Context())
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get host info: %v", err), http.StatusInternalServerError)
 		return
@@ -235,23 +1821,70 @@ func GetHostSystemInfo(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(hostInfo)
 }
 
+// writeServiceError reports a failed systemd operation, as a bad request
+// when the service name or parameters were rejected
+func writeServiceError(w http.ResponseWriter, message string, err error) {
+	if errors.Is(err, service.ErrInvalidServiceName) || errors.Is(err, service.ErrInvalidLogLines) ||
+		errors.Is(err, service.ErrInvalidServiceFilter) || errors.Is(err, service.ErrInvalidServiceScope) ||
+		errors.Is(err, service.ErrInvalidLogOutput) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, service.ErrServiceNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+}
+
 func GetSystemdServices(w http.ResponseWriter, r *http.Request) {
-	services, err := service.GetSystemdServices()
+	scope, err := service.ParseServiceScope(r.URL.Query().Get("scope"))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get services: %v", err), http.StatusInternalServerError)
+		writeServiceError(w, "Invalid scope", err)
+		return
+	}
+	query := r.URL.Query()
+	all := query.Get("all") == "true"
+
+	services, err := service.GetSystemdServices(scope, all, service.ServiceFilter{
+		State:   query.Get("state"),
+		Pattern: query.Get("pattern"),
+	})
+	if err != nil {
+		writeServiceError(w, "Failed to get services", err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(services)
 }
 
+func GetFailedServices(w http.ResponseWriter, r *http.Request) {
+	scope, err := service.ParseServiceScope(r.URL.Query().Get("scope"))
+	if err != nil {
+		writeServiceError(w, "Invalid scope", err)
+		return
+	}
+	failed, err := service.GetFailedServices(scope)
+	if err != nil {
+		writeServiceError(w, "Failed to get failed services", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(failed)
+}
+
 func GetSystemdServiceDetail(w http.ResponseWriter, r *http.Request) {
+	scope, err := service.ParseServiceScope(r.URL.Query().Get("scope"))
+	if err != nil {
+		writeServiceError(w, "Invalid scope", err)
+		return
+	}
 	vars := mux.Vars(r)
 	serviceName := vars["name"]
 
-	detail, err := service.GetSystemdServiceDetail(serviceName)
+	detail, err := service.GetSystemdServiceDetail(scope, serviceName)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get service detail: %v", err), http.StatusInternalServerError)
+		writeServiceError(w, "Failed to get service detail", err)
 		return
 	}
 
@@ -259,14 +1892,37 @@ func GetSystemdServiceDetail(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(detail)
 }
 
+func GetSystemdServiceDependencies(w http.ResponseWriter, r *http.Request) {
+	scope, err := service.ParseServiceScope(r.URL.Query().Get("scope"))
+	if err != nil {
+		writeServiceError(w, "Invalid scope", err)
+		return
+	}
+	vars := mux.Vars(r)
+	serviceName := vars["name"]
+
+	deps, err := service.GetSystemdServiceDependencies(scope, serviceName)
+	if err != nil {
+		writeServiceError(w, "Failed to get service dependencies", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deps)
+}
+
 func StartSystemdService(w http.ResponseWriter, r *http.Request) {
+	scope, err := service.ParseServiceScope(r.URL.Query().Get("scope"))
+	if err != nil {
+		writeServiceError(w, "Invalid scope", err)
+		return
+	}
 	vars := mux.Vars(r)
 	serviceName := vars["name"]
 
-	cmd := exec.Command("systemctl", "start", serviceName)
-	err := cmd.Run()
+	err = service.ControlSystemdService(scope, serviceName, "start")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to start service: %v", err), http.StatusInternalServerError)
+		writeServiceError(w, "Failed to start service", err)
 		return
 	}
 
@@ -275,13 +1931,17 @@ func StartSystemdService(w http.ResponseWriter, r *http.Request) {
 }
 
 func StopSystemdService(w http.ResponseWriter, r *http.Request) {
+	scope, err := service.ParseServiceScope(r.URL.Query().Get("scope"))
+	if err != nil {
+		writeServiceError(w, "Invalid scope", err)
+		return
+	}
 	vars := mux.Vars(r)
 	serviceName := vars["name"]
 
-	cmd := exec.Command("systemctl", "stop", serviceName)
-	err := cmd.Run()
+	err = service.ControlSystemdService(scope, serviceName, "stop")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to stop service: %v", err), http.StatusInternalServerError)
+		writeServiceError(w, "Failed to stop service", err)
 		return
 	}
 
@@ -290,13 +1950,17 @@ func StopSystemdService(w http.ResponseWriter, r *http.Request) {
 }
 
 func RestartSystemdService(w http.ResponseWriter, r *http.Request) {
+	scope, err := service.ParseServiceScope(r.URL.Query().Get("scope"))
+	if err != nil {
+		writeServiceError(w, "Invalid scope", err)
+		return
+	}
 	vars := mux.Vars(r)
 	serviceName := vars["name"]
 
-	cmd := exec.Command("systemctl", "restart", serviceName)
-	err := cmd.Run()
+	err = service.ControlSystemdService(scope, serviceName, "restart")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to restart service: %v", err), http.StatusInternalServerError)
+		writeServiceError(w, "Failed to restart service", err)
 		return
 	}
 
@@ -304,14 +1968,60 @@ func RestartSystemdService(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": "Service restarted"})
 }
 
+func ReloadSystemdService(w http.ResponseWriter, r *http.Request) {
+	scope, err := service.ParseServiceScope(r.URL.Query().Get("scope"))
+	if err != nil {
+		writeServiceError(w, "Invalid scope", err)
+		return
+	}
+	vars := mux.Vars(r)
+	serviceName := vars["name"]
+
+	err = service.ReloadSystemdService(scope, serviceName, false)
+	if errors.Is(err, service.ErrReloadNotSupported) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeServiceError(w, "Failed to reload service", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": "Service reloaded"})
+}
+
+func ReloadOrRestartSystemdService(w http.ResponseWriter, r *http.Request) {
+	scope, err := service.ParseServiceScope(r.URL.Query().Get("scope"))
+	if err != nil {
+		writeServiceError(w, "Invalid scope", err)
+		return
+	}
+	vars := mux.Vars(r)
+	serviceName := vars["name"]
+
+	err = service.ReloadSystemdService(scope, serviceName, true)
+	if err != nil {
+		writeServiceError(w, "Failed to reload or restart service", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": "Service reloaded or restarted"})
+}
+
 func EnableSystemdService(w http.ResponseWriter, r *http.Request) {
+	scope, err := service.ParseServiceScope(r.URL.Query().Get("scope"))
+	if err != nil {
+		writeServiceError(w, "Invalid scope", err)
+		return
+	}
 	vars := mux.Vars(r)
 	serviceName := vars["name"]
 
-	cmd := exec.Command("systemctl", "enable", serviceName)
-	err := cmd.Run()
+	err = service.ControlSystemdService(scope, serviceName, "enable")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to enable service: %v", err), http.StatusInternalServerError)
+		writeServiceError(w, "Failed to enable service", err)
 		return
 	}
 
@@ -320,13 +2030,17 @@ func EnableSystemdService(w http.ResponseWriter, r *http.Request) {
 }
 
 func DisableSystemdService(w http.ResponseWriter, r *http.Request) {
+	scope, err := service.ParseServiceScope(r.URL.Query().Get("scope"))
+	if err != nil {
+		writeServiceError(w, "Invalid scope", err)
+		return
+	}
 	vars := mux.Vars(r)
 	serviceName := vars["name"]
 
-	cmd := exec.Command("systemctl", "disable", serviceName)
-	err := cmd.Run()
+	err = service.ControlSystemdService(scope, serviceName, "disable")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to disable service: %v", err), http.StatusInternalServerError)
+		writeServiceError(w, "Failed to disable service", err)
 		return
 	}
 
@@ -335,30 +2049,64 @@ func DisableSystemdService(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetSystemdServiceLogs(w http.ResponseWriter, r *http.Request) {
+	scope, err := service.ParseServiceScope(r.URL.Query().Get("scope"))
+	if err != nil {
+		writeServiceError(w, "Invalid scope", err)
+		return
+	}
 	vars := mux.Vars(r)
 	serviceName := vars["name"]
 
-	// Get query parameters
-	lines := r.URL.Query().Get("lines")
-	if lines == "" {
-		lines = "100"
+	query := service.JournalQuery{
+		Lines:  r.URL.Query().Get("lines"),
+		Cursor: r.URL.Query().Get("cursor"),
+		Since:  r.URL.Query().Get("since"),
+		Until:  r.URL.Query().Get("until"),
+		Output: r.URL.Query().Get("output"),
+	}
+	if query.Lines == "" {
+		query.Lines = "100"
+	}
+	// journalctl's json output is one object per line
+	contentType := "text/plain"
+	if query.Output == "json" {
+		contentType = "application/x-ndjson"
 	}
 
 	follow := r.URL.Query().Get("follow") == "true"
 
-	var cmd *exec.Cmd
+	w, err = throttleResponse(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if follow {
-		cmd = exec.Command("journalctl", "-u", serviceName, "--no-pager", "-n", lines, "-f", "--output=short")
-	} else {
-		cmd = exec.Command("journalctl", "-u", serviceName, "--no-pager", "-n", lines, "--output=short")
+		// Stream the journal until the client goes away
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Transfer-Encoding", "chunked")
+		err := service.FollowSystemdServiceLogs(r.Context(), scope, serviceName, query, &flushWriter{w: w})
+		if errors.Is(err, service.ErrInvalidServiceName) || errors.Is(err, service.ErrInvalidLogLines) ||
+			errors.Is(err, service.ErrInvalidLogOutput) {
+			writeServiceError(w, "Failed to follow service logs", err)
+			return
+		}
+		if err != nil && r.Context().Err() == nil {
+			log.Println("journalctl follow error:", err)
+		}
+		return
 	}
 
-	output, err := cmd.Output()
+	output, cursor, err := service.GetSystemdServiceLogs(scope, serviceName, query)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get service logs: %v", err), http.StatusInternalServerError)
+		writeServiceError(w, "Failed to get service logs", err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/plain")
+	// Passed back as ?cursor= to fetch only newer entries
+	if cursor != "" {
+		w.Header().Set("X-Journal-Cursor", cursor)
+	}
+	w.Header().Set("Content-Type", contentType)
 	w.Write(output)
 }
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"docker-manager/internal/service"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// restartRequests receives a value when a self-restart has been requested
+var restartRequests = make(chan struct{}, 1)
+
+// RestartRequests returns a channel that receives when a client asks the
+// manager to restart itself
+func RestartRequests() <-chan struct{} {
+	return restartRequests
+}
+
+// Open WebSocket connections, so they can be closed cleanly on shutdown
+var (
+	wsMu    sync.Mutex
+	wsConns = make(map[*websocket.Conn]bool)
+)
+
+func trackWebSocket(conn *websocket.Conn) {
+	wsMu.Lock()
+	wsConns[conn] = true
+	wsMu.Unlock()
+}
+
+func untrackWebSocket(conn *websocket.Conn) {
+	wsMu.Lock()
+	delete(wsConns, conn)
+	wsMu.Unlock()
+}
+
+const (
+	// wsWriteWait is how long a write to a WebSocket may take
+	wsWriteWait = 10 * time.Second
+	// wsPongWait is how long to wait for a pong before the client is
+	// considered gone
+	wsPongWait = 60 * time.Second
+	// wsPingPeriod is how often clients are pinged, must be below wsPongWait
+	wsPingPeriod = wsPongWait * 9 / 10
+)
+
+// expectPongs makes reads from conn fail once no pong has arrived for
+// wsPongWait, so a read loop notices clients that dropped off the network
+func expectPongs(conn *websocket.Conn) {
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+}
+
+// CloseWebSockets sends a close frame with the given code to every open
+// WebSocket and closes it. http.Server.Shutdown doesn't touch hijacked
+// connections, so this must be called separately.
+func CloseWebSockets(code int, text string) {
+	wsMu.Lock()
+	defer wsMu.Unlock()
+
+	message := websocket.FormatCloseMessage(code, text)
+	for conn := range wsConns {
+		conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		conn.Close()
+		delete(wsConns, conn)
+	}
+}
+
+func RestartSelf(w http.ResponseWriter, r *http.Request) {
+	select {
+	case restartRequests <- struct{}{}:
+	default:
+		// A restart is already pending
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "restarting"})
+}
+
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := service.PingDocker(r.Context()); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "unavailable", "error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
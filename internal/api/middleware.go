@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"docker-manager/internal/config"
+	"docker-manager/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+// adminContextKey marks the context of requests carrying the admin token
+type adminContextKey struct{}
+
+// requireAdmin only lets requests through that carry adminToken, as checked
+// by tokenAuth. Without a configured admin token the wrapped endpoint is
+// disabled.
+func requireAdmin(adminToken string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if adminToken == "" {
+			http.Error(w, "This endpoint requires an admin token to be configured", http.StatusForbidden)
+			return
+		}
+		if !isAdmin(r) {
+			http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// isAdmin reports whether tokenAuth found the admin token on a request
+func isAdmin(r *http.Request) bool {
+	admin, _ := r.Context().Value(adminContextKey{}).(bool)
+	return admin
+}
+
+// rawEnvAllowed reports whether a request asked for unredacted environment
+// variables with ?raw_env=true. Only admins may, so anyone else gets a 403
+// and ok is false.
+func rawEnvAllowed(w http.ResponseWriter, r *http.Request) (rawEnv, ok bool) {
+	if r.URL.Query().Get("raw_env") != "true" {
+		return false, true
+	}
+	if !isAdmin(r) {
+		http.Error(w, "raw_env requires the admin token", http.StatusForbidden)
+		return false, false
+	}
+	return true, true
+}
+
+// tokenAuth returns middleware requiring token, either as a bearer token or
+// as the password of HTTP basic auth so browsers can prompt for it. The admin
+// token is accepted too, so admin endpoints only need a single Authorization
+// header, and marks the request for isAdmin. Without a token requests pass
+// through unchecked.
+func tokenAuth(token, adminToken string) mux.MiddlewareFunc {
+	if token == "" {
+		log.Println("Warning: no auth token is configured, anyone who can reach this port has full control over Docker")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided := requestToken(r)
+			if adminToken != "" && tokenMatches(provided, adminToken) {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminContextKey{}, true)))
+				return
+			}
+			if token == "" || tokenMatches(provided, token) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("WWW-Authenticate", `Basic realm="Docker Manager"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		})
+	}
+}
+
+// requestToken returns the basic auth password or bearer token of a request
+func requestToken(r *http.Request) string {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token
+}
+
+func tokenMatches(provided, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+// corsExposedHeaders are the response headers besides the basic ones that
+// cross-origin scripts may read
+const corsExposedHeaders = "Content-Disposition, X-Journal-Cursor"
+
+// corsHeaders returns middleware adding CORS headers to the responses to
+// pages from the origins allowed by service.InitCORSOrigins, and answering
+// their preflight requests before they reach authentication. Without allowed
+// origins requests pass through unchanged.
+func corsHeaders(cfg config.CORS) mux.MiddlewareFunc {
+	if len(cfg.AllowedOrigins) == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Origin")
+			origin := r.Header.Get("Origin")
+			if origin == "" || !service.CORSOriginAllowed(origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// The origin is echoed rather than "*" so it also works for
+			// requests sent with credentials
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+			w.Header().Set("Access-Control-Max-Age", maxAge)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// selectHost makes Docker calls of a request go to the host named by its
+// host query parameter, or to the primary host when there is none
+func selectHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := service.WithHost(r.Context(), r.URL.Query().Get("host"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
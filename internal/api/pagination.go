@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"docker-manager/internal/models"
+)
+
+// maxPageLimit bounds the number of items returned in a single page
+const maxPageLimit = 500
+
+// pageParams are the limit and offset query parameters of a list endpoint.
+// When neither is given the whole list is returned without a page wrapper.
+type pageParams struct {
+	limit   int
+	offset  int
+	enabled bool
+}
+
+func parsePage(r *http.Request) (pageParams, error) {
+	query := r.URL.Query()
+	page := pageParams{limit: maxPageLimit}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return page, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		page.limit = limit
+		page.enabled = true
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return page, fmt.Errorf("offset must be a non-negative integer")
+		}
+		page.offset = offset
+		page.enabled = true
+	}
+	return page, nil
+}
+
+// writeList writes items as JSON, wrapped in a models.Page when the request
+// asked for a page
+func writeList[T any](w http.ResponseWriter, page pageParams, items []T) {
+	w.Header().Set("Content-Type", "application/json")
+	if !page.enabled {
+		json.NewEncoder(w).Encode(items)
+		return
+	}
+
+	start := min(page.offset, len(items))
+	end := min(start+page.limit, len(items))
+	json.NewEncoder(w).Encode(models.Page{
+		Items:   items[start:end],
+		Total:   len(items),
+		Limit:   page.limit,
+		Offset:  page.offset,
+		HasMore: end < len(items),
+	})
+}
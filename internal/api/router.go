@@ -1,49 +1,127 @@
 package api
 
 import (
+	"docker-manager/internal/config"
 	"docker-manager/internal/web"
 	"net/http"
 
 	"github.com/gorilla/mux"
 )
 
-func NewRouter() *mux.Router {
+func NewRouter(cfg *config.Config) *mux.Router {
 	r := mux.NewRouter()
 
 	// Static files
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(web.GetStaticFS())))
 
+	// Probes for load balancers and supervisors, outside /api and without auth
+	r.HandleFunc("/healthz", Healthz).Methods("GET")
+	r.HandleFunc("/readyz", Readyz).Methods("GET")
+
+	auth := tokenAuth(cfg.Token, cfg.AdminToken)
+
 	// API routes
 	api := r.PathPrefix("/api").Subrouter()
+	api.Use(corsHeaders(cfg.CORS), auth, selectHost)
+	if len(cfg.CORS.AllowedOrigins) > 0 {
+		// Preflight requests need a route to match for corsHeaders to run,
+		// which answers them before auth
+		api.Methods("OPTIONS").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+	api.HandleFunc("/hosts", GetHosts).Methods("GET")
 	api.HandleFunc("/info", GetDockerInfo).Methods("GET")
+	api.HandleFunc("/version", GetVersion).Methods("GET")
 	api.HandleFunc("/containers", GetContainers).Methods("GET")
+	api.HandleFunc("/containers/logs/bundle", GetContainerLogsBundle).Methods("GET")
+	api.HandleFunc("/containers/logs/sizes", GetContainerLogSizes).Methods("GET")
+	api.HandleFunc("/containers/create", CreateContainer).Methods("POST")
+	api.HandleFunc("/containers/orphaned", GetOrphanedContainers).Methods("GET")
+	api.HandleFunc("/containers/stats", GetAllContainerStats).Methods("GET")
+	api.HandleFunc("/containers/stop-by-label", StopContainersByLabel).Methods("POST")
+	api.HandleFunc("/containers/batch-remove", RemoveContainers).Methods("POST")
+	api.HandleFunc("/containers/prune", PruneContainers).Methods("POST")
+	api.HandleFunc("/containers/rolling-restart", RollingRestartContainers).Methods("POST")
 	api.HandleFunc("/containers/{id}", GetContainerDetail).Methods("GET")
+	api.HandleFunc("/containers/{id}", RemoveContainer).Methods("DELETE")
+	api.HandleFunc("/containers/{id}/inspect", GetContainerInspectRaw).Methods("GET")
+	api.HandleFunc("/containers/{id}/health", GetContainerHealth).Methods("GET")
+	api.HandleFunc("/containers/{id}/usage", GetContainerUsage).Methods("GET")
+	api.HandleFunc("/containers/{id}/stats/summary", GetContainerStatsSummary).Methods("GET")
+	api.HandleFunc("/containers/{id}/stats/history", GetContainerStatsHistory).Methods("GET")
+	api.HandleFunc("/containers/{id}/stats/stream", StreamContainerStats).Methods("GET")
+	api.HandleFunc("/containers/{id}/mounts", GetContainerMounts).Methods("GET")
+	api.HandleFunc("/containers/{id}/ports", GetContainerPorts).Methods("GET")
+	api.HandleFunc("/containers/{id}/compose-file", GetContainerComposeFile).Methods("GET")
+	api.HandleFunc("/containers/{id}/update", UpdateContainer).Methods("POST")
+	api.HandleFunc("/containers/{id}/io-limits", GetContainerIOLimits).Methods("GET")
+	api.HandleFunc("/containers/{id}/io-limits", UpdateContainerIOLimits).Methods("PUT")
+	api.HandleFunc("/containers/{id}/notes", SetContainerNote).Methods("POST")
+	api.HandleFunc("/containers/{id}/exec/ws", ExecTerminal).Methods("GET")
+	api.HandleFunc("/containers/{id}/clock", GetContainerClock).Methods("GET")
+	api.HandleFunc("/containers/{id}/namespaces", GetContainerNamespaces).Methods("GET")
+	api.HandleFunc("/containers/{id}/changes", GetContainerChanges).Methods("GET")
+	api.HandleFunc("/containers/{id}/top", GetContainerTop).Methods("GET")
 	api.HandleFunc("/containers/{id}/start", StartContainer).Methods("POST")
 	api.HandleFunc("/containers/{id}/stop", StopContainer).Methods("POST")
 	api.HandleFunc("/containers/{id}/restart", RestartContainer).Methods("POST")
+	api.HandleFunc("/containers/{id}/pause", PauseContainer).Methods("POST")
+	api.HandleFunc("/containers/{id}/unpause", UnpauseContainer).Methods("POST")
+	api.HandleFunc("/containers/{id}/snapshot", SnapshotContainer).Methods("POST")
+	api.HandleFunc("/containers/{id}/export", ExportContainer).Methods("GET")
+	api.HandleFunc("/containers/{id}/files", DownloadContainerFile).Methods("GET")
+	api.HandleFunc("/containers/{id}/files", UploadContainerFile).Methods("PUT")
 	api.HandleFunc("/containers/{id}/logs", GetContainerLogs).Methods("GET")
+	api.HandleFunc("/containers/{id}/logs/stream", StreamContainerLogs).Methods("GET")
+	api.HandleFunc("/compose/validate", ValidateComposeFile).Methods("POST")
+	api.HandleFunc("/compose/projects", GetComposeProjects).Methods("GET")
+	api.HandleFunc("/compose/projects/{name}/up", ComposeProjectUp).Methods("POST")
+	api.HandleFunc("/compose/projects/{name}/down", ComposeProjectDown).Methods("POST")
+	api.HandleFunc("/compose/projects/{name}/stats", GetComposeProjectStats).Methods("GET")
 	api.HandleFunc("/images", GetImages).Methods("GET")
+	api.HandleFunc("/images/pull-batch", PullImages).Methods("POST")
+	api.HandleFunc("/images/build", BuildImage).Methods("POST")
+	api.HandleFunc("/images/{id:.+}/digests", GetImageDigests).Methods("GET")
+	api.HandleFunc("/images/{id:.+}", RemoveImage).Methods("DELETE")
+	api.HandleFunc("/registry/search", SearchRegistry).Methods("GET")
 	api.HandleFunc("/networks", GetNetworks).Methods("GET")
+	api.HandleFunc("/networks/{id}", GetNetwork).Methods("GET")
 	api.HandleFunc("/volumes", GetVolumes).Methods("GET")
+	api.HandleFunc("/volumes/prune", PruneVolumes).Methods("POST")
 	api.HandleFunc("/system/stats", GetSystemStats).Methods("GET")
 	api.HandleFunc("/system/events", GetSystemEvents).Methods("GET")
+	api.HandleFunc("/system/events/poll", PollSystemEvents).Methods("GET")
+	api.HandleFunc("/system/events/sse", StreamSystemEventsSSE).Methods("GET")
+	api.HandleFunc("/system/timeline", GetTimeline).Methods("GET")
+	api.HandleFunc("/system/cache", GetCacheStats).Methods("GET")
+	api.HandleFunc("/system/registries", GetRegistryConfig).Methods("GET")
+	api.HandleFunc("/system/bind-mounts", GetBindMounts).Methods("GET")
+	api.HandleFunc("/system/disk-forecast", GetDiskForecast).Methods("GET")
+	api.HandleFunc("/system/restart-self", requireAdmin(cfg.AdminToken, RestartSelf)).Methods("POST")
 	api.HandleFunc("/system/host", GetHostSystemInfo).Methods("GET")
 
 	// Systemd service management routes
 	api.HandleFunc("/services", GetSystemdServices).Methods("GET")
+	api.HandleFunc("/services/failed", GetFailedServices).Methods("GET")
 	api.HandleFunc("/services/{name}", GetSystemdServiceDetail).Methods("GET")
+	api.HandleFunc("/services/{name}/dependencies", GetSystemdServiceDependencies).Methods("GET")
 	api.HandleFunc("/services/{name}/start", StartSystemdService).Methods("POST")
 	api.HandleFunc("/services/{name}/stop", StopSystemdService).Methods("POST")
 	api.HandleFunc("/services/{name}/restart", RestartSystemdService).Methods("POST")
+	api.HandleFunc("/services/{name}/reload", ReloadSystemdService).Methods("POST")
+	api.HandleFunc("/services/{name}/reload-or-restart", ReloadOrRestartSystemdService).Methods("POST")
 	api.HandleFunc("/services/{name}/enable", EnableSystemdService).Methods("POST")
 	api.HandleFunc("/services/{name}/disable", DisableSystemdService).Methods("POST")
 	api.HandleFunc("/services/{name}/logs", GetSystemdServiceLogs).Methods("GET")
 
 	// WebSocket for real-time updates
-	r.HandleFunc("/ws", HandleWebSocket)
+	r.Handle("/ws", auth(selectHost(http.HandlerFunc(HandleWebSocket))))
+	r.Handle("/ws/containers/stats", auth(selectHost(http.HandlerFunc(HandleContainerStatsWebSocket))))
 
-	// Serve index.html for root path
-	r.HandleFunc("/", ServeIndex)
+	// Serve index.html for root path. It is protected as well so browsers ask
+	// for credentials on page load and reuse them for the API and WebSockets.
+	r.Handle("/", auth(http.HandlerFunc(ServeIndex)))
 
 	return r
 }
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// minStreamRate is the lowest log streaming rate a client may request, in bytes per second
+const minStreamRate = 1024
+
+// throttledWriter limits the rate at which data is written to a response
+type throttledWriter struct {
+	http.ResponseWriter
+	rate  int
+	sent  int64
+	start time.Time
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// Write at most one second's worth at a time so sleeps stay short
+		chunk := len(p)
+		if chunk > t.rate {
+			chunk = t.rate
+		}
+
+		n, err := t.ResponseWriter.Write(p[:chunk])
+		written += n
+		t.sent += int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+
+		if flusher, ok := t.ResponseWriter.(http.Flusher); ok {
+			flusher.Flush()
+		}
+
+		expected := time.Duration(float64(t.sent) / float64(t.rate) * float64(time.Second))
+		if elapsed := time.Since(t.start); expected > elapsed {
+			time.Sleep(expected - elapsed)
+		}
+	}
+	return written, nil
+}
+
+func (t *throttledWriter) Flush() {
+	if flusher, ok := t.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// throttleResponse wraps w in a throttledWriter when the request sets a
+// rate query parameter. Rates below minStreamRate are raised to it. w is
+// returned unchanged with an invalid rate so the error can be written to it.
+func throttleResponse(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, error) {
+	value := r.URL.Query().Get("rate")
+	if value == "" {
+		return w, nil
+	}
+
+	rate, err := strconv.Atoi(value)
+	if err != nil || rate <= 0 {
+		return w, fmt.Errorf("rate must be a positive number of bytes per second")
+	}
+	if rate < minStreamRate {
+		rate = minStreamRate
+	}
+
+	return &throttledWriter{ResponseWriter: w, rate: rate, start: time.Now()}, nil
+}
+
+// flushWriter flushes the response after every write so streamed output
+// reaches the client immediately
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,263 @@
+// Package config loads the server configuration from a config file,
+// environment variables and defaults, in that order of precedence.
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the settings that can be given in a config file. Settings
+// missing from the file fall back to environment variables, then defaults.
+type Config struct {
+	// Port is the port to listen on (DOCKER_MANAGER_PORT, default 8080)
+	Port string `yaml:"port"`
+	// DockerHost is the daemon address (DOCKER_HOST, default the local socket)
+	DockerHost string `yaml:"docker_host"`
+	// TLS holds the certificates used to connect to DockerHost
+	TLS TLS `yaml:"tls"`
+	// HostID names the DockerHost daemon, the primary host
+	// (DOCKER_MANAGER_HOST_ID, default "local")
+	HostID string `yaml:"host_id"`
+	// Hosts are additional daemons requests can select with ?host=<id>
+	Hosts []Host `yaml:"hosts"`
+	// Token protects the UI, API and WebSockets (DOCKER_MANAGER_TOKEN)
+	Token string `yaml:"token"`
+	// AdminToken additionally unlocks admin endpoints such as restart-self
+	// (DOCKER_MANAGER_ADMIN_TOKEN)
+	AdminToken string `yaml:"admin_token"`
+	// AllowedOrigins may open WebSockets besides the server's own origin
+	// (DOCKER_MANAGER_ALLOWED_ORIGINS, comma-separated)
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// AllowAllOrigins disables the WebSocket origin check
+	// (DOCKER_MANAGER_ALLOW_ALL_ORIGINS)
+	AllowAllOrigins bool `yaml:"allow_all_origins"`
+	// CORS lets browser apps served from other origins call the API
+	CORS CORS `yaml:"cors"`
+	// RequestTimeout bounds a single Docker API call
+	// (DOCKER_MANAGER_DOCKER_TIMEOUT, default 30s)
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	// RedactEnv masks the values of secret-looking environment variables in
+	// container details (DOCKER_MANAGER_REDACT_ENV, default true)
+	RedactEnv bool `yaml:"redact_env"`
+	// RedactEnvPatterns are the case-insensitive substrings that mark an
+	// environment variable name as secret
+	// (DOCKER_MANAGER_REDACT_ENV_PATTERNS, comma-separated)
+	RedactEnvPatterns []string `yaml:"redact_env_patterns"`
+	// ServiceAllowlist are the systemd unit names or globs listed by default
+	// (DOCKER_MANAGER_SERVICE_ALLOWLIST, comma-separated)
+	ServiceAllowlist []string `yaml:"service_allowlist"`
+	// Registries holds credentials for private registries, used before
+	// those saved by `docker login`
+	Registries []Registry `yaml:"registries"`
+}
+
+// CORS configures the cross-origin requests browsers may make to /api.
+// Without allowed origins no CORS headers are sent, so only pages served by
+// the manager itself can call the API.
+type CORS struct {
+	// AllowedOrigins may call the API, "*" allows any origin
+	// (DOCKER_MANAGER_CORS_ORIGINS, comma-separated)
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// AllowedMethods (DOCKER_MANAGER_CORS_METHODS, comma-separated, default
+	// GET, POST, PUT and DELETE)
+	AllowedMethods []string `yaml:"allowed_methods"`
+	// AllowedHeaders are the request headers scripts may set
+	// (DOCKER_MANAGER_CORS_HEADERS, comma-separated, default Authorization,
+	// Content-Type and X-Registry-Auth)
+	AllowedHeaders []string `yaml:"allowed_headers"`
+	// MaxAge is how long browsers may cache a preflight response (default 10m)
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// Registry holds the credentials for a registry such as ghcr.io. Token is a
+// bearer token used instead of a username and password.
+type Registry struct {
+	Host     string `yaml:"host"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Token    string `yaml:"token"`
+}
+
+// Host is an additional Docker daemon to manage
+type Host struct {
+	ID         string `yaml:"id"`
+	DockerHost string `yaml:"docker_host"`
+	TLS        TLS    `yaml:"tls"`
+}
+
+// TLS holds the paths of the certificates used to connect to a daemon over
+// TLS. CACert verifies the daemon, Cert and Key authenticate the manager.
+type TLS struct {
+	// CACert is the CA certificate (DOCKER_MANAGER_TLS_CA_CERT)
+	CACert string `yaml:"ca_cert"`
+	// Cert is the client certificate (DOCKER_MANAGER_TLS_CERT)
+	Cert string `yaml:"cert"`
+	// Key is the client key (DOCKER_MANAGER_TLS_KEY)
+	Key string `yaml:"key"`
+}
+
+// Enabled reports whether any certificate is configured
+func (t TLS) Enabled() bool {
+	return t.CACert != "" || t.Cert != "" || t.Key != ""
+}
+
+func (t TLS) validate() error {
+	if (t.Cert == "") != (t.Key == "") {
+		return fmt.Errorf("a TLS client certificate and key must be given together")
+	}
+	return nil
+}
+
+// Default returns the configuration used when nothing is set
+func Default() *Config {
+	return &Config{
+		Port:           "8080",
+		HostID:         "local",
+		RequestTimeout: 30 * time.Second,
+		CORS: CORS{
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "X-Registry-Auth"},
+			MaxAge:         10 * time.Minute,
+		},
+		RedactEnv:         true,
+		RedactEnvPatterns: []string{"PASSWORD", "PASSWD", "SECRET", "TOKEN", "KEY", "CREDENTIAL"},
+	}
+}
+
+// Load builds the configuration from the defaults, the environment and, when
+// path isn't empty, the YAML or JSON file at path
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		// JSON is valid YAML, so one decoder handles both formats
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.TLS.validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateHosts(); err != nil {
+		return nil, err
+	}
+	for _, registry := range cfg.Registries {
+		if registry.Host == "" {
+			return nil, fmt.Errorf("every entry in registries needs a host")
+		}
+	}
+	if cfg.CORS.MaxAge < 0 {
+		return nil, fmt.Errorf("cors max_age can't be negative, got %s", cfg.CORS.MaxAge)
+	}
+	if cfg.RequestTimeout <= 0 {
+		return nil, fmt.Errorf("request timeout must be positive, got %s", cfg.RequestTimeout)
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadEnv() error {
+	if value := os.Getenv("DOCKER_MANAGER_PORT"); value != "" {
+		c.Port = value
+	}
+	c.DockerHost = os.Getenv("DOCKER_HOST")
+	c.TLS.CACert = os.Getenv("DOCKER_MANAGER_TLS_CA_CERT")
+	c.TLS.Cert = os.Getenv("DOCKER_MANAGER_TLS_CERT")
+	c.TLS.Key = os.Getenv("DOCKER_MANAGER_TLS_KEY")
+	if value := os.Getenv("DOCKER_MANAGER_HOST_ID"); value != "" {
+		c.HostID = value
+	}
+	c.Token = os.Getenv("DOCKER_MANAGER_TOKEN")
+	c.AdminToken = os.Getenv("DOCKER_MANAGER_ADMIN_TOKEN")
+
+	c.AllowedOrigins = splitList(os.Getenv("DOCKER_MANAGER_ALLOWED_ORIGINS"))
+
+	if value := os.Getenv("DOCKER_MANAGER_ALLOW_ALL_ORIGINS"); value != "" {
+		allowAll, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("DOCKER_MANAGER_ALLOW_ALL_ORIGINS must be true or false, got %q", value)
+		}
+		c.AllowAllOrigins = allowAll
+	}
+
+	if value := os.Getenv("DOCKER_MANAGER_REDACT_ENV"); value != "" {
+		redact, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("DOCKER_MANAGER_REDACT_ENV must be true or false, got %q", value)
+		}
+		c.RedactEnv = redact
+	}
+
+	if value := os.Getenv("DOCKER_MANAGER_REDACT_ENV_PATTERNS"); value != "" {
+		c.RedactEnvPatterns = splitList(value)
+	}
+
+	c.ServiceAllowlist = splitList(os.Getenv("DOCKER_MANAGER_SERVICE_ALLOWLIST"))
+
+	c.CORS.AllowedOrigins = splitList(os.Getenv("DOCKER_MANAGER_CORS_ORIGINS"))
+	if value := os.Getenv("DOCKER_MANAGER_CORS_METHODS"); value != "" {
+		c.CORS.AllowedMethods = splitList(value)
+	}
+	if value := os.Getenv("DOCKER_MANAGER_CORS_HEADERS"); value != "" {
+		c.CORS.AllowedHeaders = splitList(value)
+	}
+
+	if value := os.Getenv("DOCKER_MANAGER_DOCKER_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("DOCKER_MANAGER_DOCKER_TIMEOUT must be a positive duration, got %q", value)
+		}
+		c.RequestTimeout = timeout
+	}
+	return nil
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (c *Config) validateHosts() error {
+	if c.HostID == "" {
+		return fmt.Errorf("host_id can't be empty")
+	}
+
+	seen := map[string]bool{c.HostID: true}
+	for _, host := range c.Hosts {
+		if host.ID == "" || host.DockerHost == "" {
+			return fmt.Errorf("every entry in hosts needs an id and a docker_host")
+		}
+		if seen[host.ID] {
+			return fmt.Errorf("duplicate host id %q", host.ID)
+		}
+		seen[host.ID] = true
+		if err := host.TLS.validate(); err != nil {
+			return fmt.Errorf("host %s: %w", host.ID, err)
+		}
+	}
+	return nil
+}
+
+// Addr returns the address to listen on
+func (c *Config) Addr() string {
+	return ":" + c.Port
+}
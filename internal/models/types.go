@@ -1,11 +1,16 @@
 package models
 
 import (
+	"time"
+
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/pkg/jsonmessage"
 )
 
 type DockerInfo struct {
+	HostID     string                  `json:"host_id,omitempty"`
 	SystemInfo *types.Info             `json:"system_info"`
 	Version    types.Version           `json:"version"`
 	Containers []types.Container       `json:"containers"`
@@ -15,9 +20,497 @@ type DockerInfo struct {
 	DiskUsage  types.DiskUsage         `json:"disk_usage"`
 }
 
+// VersionInfo describes the running build of docker-manager and the Docker
+// API version it talks to the selected host with
+type VersionInfo struct {
+	Version          string `json:"version"`
+	Commit           string `json:"commit"`
+	BuildDate        string `json:"build_date"`
+	GoVersion        string `json:"go_version"`
+	DockerAPIVersion string `json:"docker_api_version"`
+}
+
+// DockerHost is a Docker daemon the manager is connected to
+type DockerHost struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Primary bool   `json:"primary"`
+}
+
 type ContainerDetail struct {
-	Container types.ContainerJSON `json:"container"`
-	Stats     *types.StatsJSON    `json:"stats,omitempty"`
+	Container     types.ContainerJSON `json:"container"`
+	Stats         *types.StatsJSON    `json:"stats,omitempty"`
+	ComputedStats *ComputedStats      `json:"computed_stats,omitempty"`
+	Usage         *ContainerUsage     `json:"usage,omitempty"`
+	StopSignal    string              `json:"stop_signal"`
+	AutoRemove    bool                `json:"auto_remove"`
+	Note          *ContainerNote      `json:"note,omitempty"`
+	Health        *ContainerHealth    `json:"health,omitempty"`
+}
+
+// HealthCheckResult is a single run of a container's healthcheck
+type HealthCheckResult struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	ExitCode int       `json:"exit_code"`
+	Output   string    `json:"output"`
+}
+
+// ContainerHealth is the healthcheck state of a container with its most
+// recent results, oldest first. Status is "none" without a healthcheck.
+type ContainerHealth struct {
+	Status        string              `json:"status"`
+	FailingStreak int                 `json:"failing_streak"`
+	Log           []HealthCheckResult `json:"log"`
+}
+
+// NetworkTotals are the traffic counters of a single network interface
+type NetworkTotals struct {
+	RxBytes   uint64 `json:"rx_bytes"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	TxPackets uint64 `json:"tx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	TxErrors  uint64 `json:"tx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+// ComputedStats are values derived from a raw stats sample so clients
+// don't need to repeat the calculations
+type ComputedStats struct {
+	CPUPercent    float64                  `json:"cpu_percent"`
+	OnlineCPUs    uint32                   `json:"online_cpus"`
+	MemoryUsage   uint64                   `json:"memory_usage"`
+	MemoryLimit   uint64                   `json:"memory_limit"`
+	MemoryPercent float64                  `json:"memory_percent"`
+	Networks      map[string]NetworkTotals `json:"networks"`
+}
+
+// Page is one page of a list, returned when a list endpoint is called with
+// limit or offset
+type Page struct {
+	Items   interface{} `json:"items"`
+	Total   int         `json:"total"`
+	Limit   int         `json:"limit"`
+	Offset  int         `json:"offset"`
+	HasMore bool        `json:"has_more"`
+}
+
+// ContainerNote holds free-text notes and tags attached to a container by
+// the manager rather than as Docker labels
+type ContainerNote struct {
+	Notes     string    `json:"notes"`
+	Tags      []string  `json:"tags"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrphanedContainer is a container whose image no longer exists locally
+type OrphanedContainer struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Image    string `json:"image"`
+	ImageID  string `json:"image_id"`
+	State    string `json:"state"`
+	Orphaned bool   `json:"orphaned"`
+}
+
+// NamespaceMode describes how one namespace of a container is set up. When
+// the namespace is shared with another container, Container names it.
+type NamespaceMode struct {
+	Mode      string `json:"mode"`
+	Container string `json:"container,omitempty"`
+	Host      bool   `json:"host"`
+}
+
+// ContainerNamespaces describes the namespaces a container shares
+type ContainerNamespaces struct {
+	Network NamespaceMode `json:"network"`
+	PID     NamespaceMode `json:"pid"`
+	IPC     NamespaceMode `json:"ipc"`
+	UTS     NamespaceMode `json:"uts"`
+	Userns  NamespaceMode `json:"userns"`
+}
+
+// ContainerChange is a path changed in a container's filesystem relative to
+// its image. Kind is "added", "modified" or "deleted".
+type ContainerChange struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+}
+
+// ContainerClock compares a container's clock with the host clock, in Unix seconds
+type ContainerClock struct {
+	HostTime      int64  `json:"host_time"`
+	ContainerTime int64  `json:"container_time,omitempty"`
+	DriftSeconds  int64  `json:"drift_seconds"`
+	Supported     bool   `json:"supported"`
+	Error         string `json:"error,omitempty"`
+}
+
+// ContainerSummary extends a container list entry with details from inspect
+type ContainerSummary struct {
+	types.Container
+	AutoRemove bool   `json:"auto_remove"`
+	Health     string `json:"health,omitempty"`
+}
+
+// ContainerUsage reports a container's resource usage relative to its limits
+type ContainerUsage struct {
+	MemoryUsage   uint64  `json:"memory_usage"`
+	MemoryLimit   int64   `json:"memory_limit"`
+	MemoryPercent float64 `json:"memory_percent"`
+	MemoryLimited bool    `json:"memory_limited"`
+	CPUQuota      int64   `json:"cpu_quota"`
+	CPUPeriod     int64   `json:"cpu_period"`
+	NanoCPUs      int64   `json:"nano_cpus"`
+	CPULimit      float64 `json:"cpu_limit"`
+}
+
+// ContainerStatsSample is a point-in-time resource usage sample of a container
+type ContainerStatsSample struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Time          time.Time `json:"time"`
+	CPUPercent    float64   `json:"cpu_percent"`
+	MemoryUsage   uint64    `json:"memory_usage"`
+	MemoryLimit   uint64    `json:"memory_limit"`
+	MemoryPercent float64   `json:"memory_percent"`
+	NetworkRx     uint64    `json:"network_rx"`
+	NetworkTx     uint64    `json:"network_tx"`
+}
+
+// StatsAggregate summarizes one metric over a window of samples
+type StatsAggregate struct {
+	Current float64 `json:"current"`
+	Average float64 `json:"average"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+}
+
+// ContainerStatsSummary summarizes a container's resource usage over a window
+type ContainerStatsSummary struct {
+	ID            string         `json:"id"`
+	Name          string         `json:"name"`
+	Window        string         `json:"window"`
+	Samples       int            `json:"samples"`
+	From          time.Time      `json:"from"`
+	To            time.Time      `json:"to"`
+	CPUPercent    StatsAggregate `json:"cpu_percent"`
+	MemoryUsage   StatsAggregate `json:"memory_usage"`
+	MemoryPercent StatsAggregate `json:"memory_percent"`
+}
+
+// ContainerStatsHistory holds the recorded stats samples of a container,
+// oldest first, taken every Interval
+type ContainerStatsHistory struct {
+	ID       string                 `json:"id"`
+	Name     string                 `json:"name"`
+	Window   string                 `json:"window"`
+	Interval string                 `json:"interval"`
+	Samples  []ContainerStatsSample `json:"samples"`
+}
+
+// ContainerCreateRequest describes a container to create. Ports are given as
+// "[host-ip:]host-port:container-port[/protocol]" and Env as "KEY=value".
+// RestartPolicy is one of "no", "always", "unless-stopped" or
+// "on-failure[:max-retries]".
+type ContainerCreateRequest struct {
+	Image         string   `json:"image"`
+	Name          string   `json:"name"`
+	Ports         []string `json:"ports"`
+	Env           []string `json:"env"`
+	RestartPolicy string   `json:"restart_policy"`
+	Pull          bool     `json:"pull"`
+}
+
+// ContainerCreateResult identifies a newly created container
+type ContainerCreateResult struct {
+	ID       string   `json:"id"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ContainerUpdateRequest changes the resource limits and restart policy of an
+// existing container. Zero values and an empty RestartPolicy leave the current
+// setting unchanged. MemorySwap is the limit of memory plus swap, -1 for
+// unlimited swap; it has to be raised with Memory on containers that have one.
+type ContainerUpdateRequest struct {
+	Memory        int64  `json:"memory"`
+	MemorySwap    int64  `json:"memory_swap"`
+	CPUShares     int64  `json:"cpu_shares"`
+	CPUQuota      int64  `json:"cpu_quota"`
+	RestartPolicy string `json:"restart_policy"`
+}
+
+// ContainerUpdateResult holds the warnings reported by the daemon for an update
+type ContainerUpdateResult struct {
+	Warnings []string `json:"warnings"`
+}
+
+// PortMapping is a container port and, when published, the host address it
+// is reachable on
+type PortMapping struct {
+	ContainerPort int    `json:"container_port"`
+	Protocol      string `json:"protocol"`
+	HostIP        string `json:"host_ip,omitempty"`
+	HostPort      string `json:"host_port,omitempty"`
+}
+
+// ContainerMount describes a mount as seen by the container
+type ContainerMount struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Driver      string `json:"driver,omitempty"`
+	Mode        string `json:"mode,omitempty"`
+	ReadOnly    bool   `json:"read_only"`
+	Propagation string `json:"propagation,omitempty"`
+}
+
+// BindMountUse is a container that bind-mounts a host path
+type BindMountUse struct {
+	ContainerID   string `json:"container_id"`
+	ContainerName string `json:"container_name"`
+	Destination   string `json:"destination"`
+	ReadOnly      bool   `json:"read_only"`
+}
+
+// HostBindMount is a host path and every container that bind-mounts it
+type HostBindMount struct {
+	HostPath   string         `json:"host_path"`
+	Containers []BindMountUse `json:"containers"`
+}
+
+// ImageDetail extends an image summary with details derived from local containers
+type ImageDetail struct {
+	types.ImageSummary
+	LastUsed *time.Time `json:"last_used"`
+}
+
+// VolumeBackupResult reports the outcome of backing up a single volume
+type VolumeBackupResult struct {
+	Volume      string `json:"volume"`
+	Destination string `json:"destination"`
+	File        string `json:"file,omitempty"`
+	Bytes       int64  `json:"bytes"`
+	Error       string `json:"error,omitempty"`
+}
+
+// VolumePruneResult lists the volumes removed by a prune and the disk space freed
+type VolumePruneResult struct {
+	VolumesDeleted []string `json:"volumes_deleted"`
+	SpaceReclaimed uint64   `json:"space_reclaimed"`
+}
+
+// ContainerSnapshot is the manifest of a stop/backup/restart snapshot
+type ContainerSnapshot struct {
+	Container    string               `json:"container"`
+	CreatedAt    time.Time            `json:"created_at"`
+	Stopped      bool                 `json:"stopped"`
+	Restarted    bool                 `json:"restarted"`
+	RestartError string               `json:"restart_error,omitempty"`
+	Volumes      []VolumeBackupResult `json:"volumes"`
+}
+
+// LogLine is a single line of container output. Stream is "stdout" or
+// "stderr", or "tty" for containers with a terminal where the two are merged.
+type LogLine struct {
+	Stream string `json:"stream"`
+	Line   string `json:"line"`
+}
+
+// ContainerLogSize reports the on-disk size of a container's json-file log
+type ContainerLogSize struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	LogPath string `json:"log_path"`
+	Size    int64  `json:"size"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ContainerActionResult reports the outcome of an action on one container
+// as part of an operation on several containers
+type ContainerActionResult struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RollingRestartResult reports the progress of a rolling restart
+type RollingRestartResult struct {
+	Results []ContainerActionResult `json:"results"`
+	Aborted bool                    `json:"aborted"`
+}
+
+// ComposeFile is a compose file referenced by a container's labels
+type ComposeFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ContainerComposeFiles lists the compose files that defined a container
+type ContainerComposeFiles struct {
+	Project    string        `json:"project"`
+	WorkingDir string        `json:"working_dir"`
+	Files      []ComposeFile `json:"files"`
+}
+
+// ComposeValidationError is a problem found in a compose file. Line is zero
+// when the error doesn't point at a particular line.
+type ComposeValidationError struct {
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+}
+
+// ComposeValidation is the result of validating a compose file. Config holds
+// the normalized configuration when the file is valid.
+type ComposeValidation struct {
+	Valid  bool                     `json:"valid"`
+	Config string                   `json:"config,omitempty"`
+	Errors []ComposeValidationError `json:"errors"`
+}
+
+// ResourceTotals is the combined resource usage of a group of containers
+type ResourceTotals struct {
+	Containers  int     `json:"containers"`
+	CPUPercent  float64 `json:"cpu_percent"`
+	MemoryUsage uint64  `json:"memory_usage"`
+	NetworkRx   uint64  `json:"network_rx"`
+	NetworkTx   uint64  `json:"network_tx"`
+}
+
+// ComposeContainer is a container belonging to a compose service
+type ComposeContainer struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	State  string `json:"state"`
+	Status string `json:"status"`
+}
+
+// ComposeService groups the containers of one service of a compose project
+type ComposeService struct {
+	Name       string             `json:"name"`
+	Running    int                `json:"running"`
+	Total      int                `json:"total"`
+	Containers []ComposeContainer `json:"containers"`
+}
+
+// ComposeProject groups the containers of a compose project by service.
+// Status is "running" when every container runs, "stopped" when none does
+// and "partial" otherwise.
+type ComposeProject struct {
+	Name       string           `json:"name"`
+	WorkingDir string           `json:"working_dir,omitempty"`
+	Status     string           `json:"status"`
+	Running    int              `json:"running"`
+	Total      int              `json:"total"`
+	Services   []ComposeService `json:"services"`
+}
+
+// ComposeServiceStats is the resource usage of one service of a compose project
+type ComposeServiceStats struct {
+	Service string `json:"service"`
+	ResourceTotals
+}
+
+// ComposeProjectStats is the resource usage of the running containers of a
+// compose project, in total and per service
+type ComposeProjectStats struct {
+	Project  string                  `json:"project"`
+	Total    ResourceTotals          `json:"total"`
+	Services []ComposeServiceStats   `json:"services"`
+	Errors   []ContainerActionResult `json:"errors,omitempty"`
+}
+
+// DeviceWeight is a relative block I/O weight for a single device
+type DeviceWeight struct {
+	Path   string `json:"path"`
+	Weight uint16 `json:"weight"`
+}
+
+// DeviceRate is a block I/O rate limit for a single device, in bytes or
+// operations per second
+type DeviceRate struct {
+	Path string `json:"path"`
+	Rate uint64 `json:"rate"`
+}
+
+// ContainerIOLimits are the block I/O limits of a container
+type ContainerIOLimits struct {
+	BlkioWeight     uint16         `json:"blkio_weight"`
+	WeightDevices   []DeviceWeight `json:"weight_devices"`
+	DeviceReadBps   []DeviceRate   `json:"device_read_bps"`
+	DeviceWriteBps  []DeviceRate   `json:"device_write_bps"`
+	DeviceReadIOps  []DeviceRate   `json:"device_read_iops"`
+	DeviceWriteIOps []DeviceRate   `json:"device_write_iops"`
+	Warnings        []string       `json:"warnings,omitempty"`
+}
+
+// ImageDigests holds the digests identifying an image locally and, when the
+// registry can be reached, the manifest it was published under
+type ImageDigests struct {
+	ID                string   `json:"id"`
+	ConfigDigest      string   `json:"config_digest"`
+	RepoDigests       []string `json:"repo_digests"`
+	Reference         string   `json:"reference,omitempty"`
+	ManifestDigest    string   `json:"manifest_digest,omitempty"`
+	MediaType         string   `json:"media_type,omitempty"`
+	Platforms         []string `json:"platforms,omitempty"`
+	DistributionError string   `json:"distribution_error,omitempty"`
+}
+
+// PullEvent is a line in a streamed image pull. Status is "pulling" when an
+// image starts, "progress" for daemon progress messages and "done" or
+// "failed" when it finishes.
+type PullEvent struct {
+	Image    string                   `json:"image"`
+	Status   string                   `json:"status"`
+	Progress *jsonmessage.JSONMessage `json:"progress,omitempty"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+// PullResult is the outcome of pulling a single image
+type PullResult struct {
+	Image  string `json:"image"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImageBuildResult is the outcome of an image build. Step is the build step
+// that failed, as reported by the daemon (e.g. "Step 3/5 : RUN make").
+type ImageBuildResult struct {
+	Status  string   `json:"status"`
+	ImageID string   `json:"image_id,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Step    string   `json:"step,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// TimelineEvent is the creation of a container or image on the host
+type TimelineEvent struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	ID   string    `json:"id"`
+	Name string    `json:"name"`
+}
+
+// CacheStats reports the effectiveness of one of the manager's caches
+type CacheStats struct {
+	Name       string  `json:"name"`
+	TTLSeconds float64 `json:"ttl_seconds"`
+	Entries    int     `json:"entries"`
+	Hits       uint64  `json:"hits"`
+	Misses     uint64  `json:"misses"`
+}
+
+// WebSocketMessage is the envelope of every message sent over /ws. Type is
+// "event" for a Docker event or "stats" for a SystemStats snapshot.
+type WebSocketMessage struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
 }
 
 type SystemStats struct {
@@ -39,18 +532,78 @@ type SystemStats struct {
 	} `json:"volumes"`
 }
 
+// DiskForecast reports the usage of a filesystem and, once enough history
+// has been recorded, how fast it grows and when it will be full. The
+// forecast fields are omitted while the history is too short or when the
+// filesystem isn't growing.
+type DiskForecast struct {
+	Label              string   `json:"label"`
+	Path               string   `json:"path"`
+	Total              uint64   `json:"total"`
+	Used               uint64   `json:"used"`
+	Available          uint64   `json:"available"`
+	UsedPercent        float64  `json:"used_percent"`
+	Samples            int      `json:"samples"`
+	GrowthBytesPerHour *float64 `json:"growth_bytes_per_hour,omitempty"`
+	HoursUntilFull     *float64 `json:"hours_until_full,omitempty"`
+	Error              string   `json:"error,omitempty"`
+}
+
+// RegistryIndex describes how the daemon talks to a single registry
+type RegistryIndex struct {
+	Name     string   `json:"name"`
+	Mirrors  []string `json:"mirrors"`
+	Secure   bool     `json:"secure"`
+	Official bool     `json:"official"`
+}
+
+// RegistryConfig is the registry configuration of the Docker daemon
+type RegistryConfig struct {
+	Mirrors            []string        `json:"mirrors"`
+	InsecureRegistries []string        `json:"insecure_registries"`
+	Indexes            []RegistryIndex `json:"indexes"`
+}
+
+// EventPoll is a batch of Docker events returned to a polling client along
+// with the cursor to request the next batch
+type EventPoll struct {
+	Events []events.Message `json:"events"`
+	Cursor int64            `json:"cursor"`
+}
+
+// FilesystemUsage is the space used on a mounted filesystem. DockerDataRoot
+// marks the filesystem holding the Docker data root.
+type FilesystemUsage struct {
+	Mountpoint     string  `json:"mountpoint"`
+	Device         string  `json:"device"`
+	Type           string  `json:"type"`
+	Total          uint64  `json:"total"`
+	Used           uint64  `json:"used"`
+	Available      uint64  `json:"available"`
+	UsedPct        float64 `json:"used_percent"`
+	DockerDataRoot bool    `json:"docker_data_root,omitempty"`
+}
+
+// HostSystemInfo describes the machine the manager runs on. Supported is
+// false on platforms where only the CPU cores and root filesystem are known.
 type HostSystemInfo struct {
-	Uptime             string  `json:"uptime"`
-	UptimeSeconds      int64   `json:"uptime_seconds"`
-	LoadAverage1       float64 `json:"load_avg_1"`
-	LoadAverage5       float64 `json:"load_avg_5"`
-	LoadAverage15      float64 `json:"load_avg_15"`
-	MemoryTotal        int64   `json:"memory_total"`
-	MemoryUsed         int64   `json:"memory_used"`
-	MemoryAvailable    int64   `json:"memory_available"`
-	MemoryUsedPct      float64 `json:"memory_used_percent"`
-	NetworkConnections int     `json:"network_connections"`
-	CPUCores           int     `json:"cpu_cores"`
+	Platform           string            `json:"platform"`
+	Supported          bool              `json:"supported"`
+	Uptime             string            `json:"uptime"`
+	UptimeSeconds      int64             `json:"uptime_seconds"`
+	LoadAverage1       float64           `json:"load_avg_1"`
+	LoadAverage5       float64           `json:"load_avg_5"`
+	LoadAverage15      float64           `json:"load_avg_15"`
+	MemoryTotal        int64             `json:"memory_total"`
+	MemoryUsed         int64             `json:"memory_used"`
+	MemoryAvailable    int64             `json:"memory_available"`
+	MemoryUsedPct      float64           `json:"memory_used_percent"`
+	SwapTotal          int64             `json:"swap_total"`
+	SwapUsed           int64             `json:"swap_used"`
+	SwapUsedPct        float64           `json:"swap_used_percent"`
+	NetworkConnections int               `json:"network_connections"`
+	CPUCores           int               `json:"cpu_cores"`
+	Filesystems        []FilesystemUsage `json:"filesystems"`
 }
 
 // SystemdService represents a systemd service
@@ -67,6 +620,12 @@ type SystemdService struct {
 	Tasks       string `json:"tasks"`
 }
 
+// FailedServices lists the systemd services in the failed state
+type FailedServices struct {
+	Count    int              `json:"count"`
+	Services []SystemdService `json:"services"`
+}
+
 // SystemdServiceDetail represents detailed information about a systemd service
 type SystemdServiceDetail struct {
 	Service SystemdService    `json:"service"`
@@ -74,3 +633,17 @@ type SystemdServiceDetail struct {
 	Logs    []string          `json:"logs"`
 	Props   map[string]string `json:"properties"`
 }
+
+// SystemdDependency is a node in a systemd unit's dependency tree
+type SystemdDependency struct {
+	Unit         string               `json:"unit"`
+	Dependencies []*SystemdDependency `json:"dependencies,omitempty"`
+}
+
+// SystemdServiceDependencies describes the units a systemd service depends on
+type SystemdServiceDependencies struct {
+	Unit     string               `json:"unit"`
+	Requires []string             `json:"requires"`
+	Wants    []string             `json:"wants"`
+	Tree     []*SystemdDependency `json:"tree"`
+}
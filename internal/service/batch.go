@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"docker-manager/internal/models"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// statePollInterval is how often a container is inspected while waiting for it
+const statePollInterval = 500 * time.Millisecond
+
+// waitForState polls a container until ready reports true or ctx expires,
+// returning the last observed state
+func waitForState(ctx context.Context, containerID string, ready func(*types.ContainerState) (bool, error)) (*types.ContainerState, error) {
+	ticker := time.NewTicker(statePollInterval)
+	defer ticker.Stop()
+
+	for {
+		containerJSON, err := DockerClient(ctx).ContainerInspect(ctx, containerID)
+		if err != nil {
+			return nil, err
+		}
+		if containerJSON.State != nil {
+			done, err := ready(containerJSON.State)
+			if err != nil || done {
+				return containerJSON.State, err
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if containerJSON.State != nil {
+				return containerJSON.State, fmt.Errorf("timed out waiting for container (status %s)", containerJSON.State.Status)
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// WaitForContainerState waits up to timeout for a container to reach status,
+// such as running or exited, and returns its final state
+func WaitForContainerState(ctx context.Context, containerID, status string, timeout time.Duration) (*types.ContainerState, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return waitForState(ctx, containerID, func(state *types.ContainerState) (bool, error) {
+		return state.Status == status, nil
+	})
+}
+
+// listContainers lists containers straight from the daemon, bypassing the
+// read cache, bounded by RequestTimeout
+func listContainers(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	return DockerClient(ctx).ContainerList(ctx, options)
+}
+
+// runningAndHealthy is ready once a container is running and, if it has a
+// healthcheck, reported healthy
+func runningAndHealthy(state *types.ContainerState) (bool, error) {
+	if !state.Running {
+		if state.Status == "exited" || state.Status == "dead" {
+			return false, fmt.Errorf("container %s with exit code %d", state.Status, state.ExitCode)
+		}
+		return false, nil
+	}
+	if state.Health == nil {
+		return true, nil
+	}
+	switch state.Health.Status {
+	case types.Healthy:
+		return true, nil
+	case types.Unhealthy:
+		return false, fmt.Errorf("container is unhealthy")
+	}
+	return false, nil
+}
+
+// RollingRestart restarts the running containers whose name starts with
+// prefix and/or carry label, one at a time. Each container must be running
+// (and healthy, when it has a healthcheck) within timeout before the next
+// one is restarted; on failure the remaining containers are left untouched.
+func RollingRestart(ctx context.Context, prefix, label string, timeout time.Duration) (*models.RollingRestartResult, error) {
+	if prefix == "" && label == "" {
+		return nil, fmt.Errorf("a name prefix or label selector is required")
+	}
+
+	options := types.ContainerListOptions{}
+	if label != "" {
+		options.Filters = filters.NewArgs(filters.Arg("label", label))
+	}
+	containers, err := listContainers(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []types.Container
+	for _, c := range containers {
+		if prefix == "" || strings.HasPrefix(containerName(c), prefix) {
+			targets = append(targets, c)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return containerName(targets[i]) < containerName(targets[j])
+	})
+
+	batch := startBatch("rolling-restart")
+	defer batch.finish()
+
+	result := &models.RollingRestartResult{Results: []models.ContainerActionResult{}}
+	for i, c := range targets {
+		step := models.ContainerActionResult{ID: c.ID, Name: containerName(c), Status: "restarted"}
+
+		batch.track(c.ID)
+		err := RestartContainer(ctx, c.ID, nil)
+		if err == nil {
+			waitCtx, cancel := context.WithTimeout(ctx, timeout)
+			_, err = waitForState(waitCtx, c.ID, runningAndHealthy)
+			cancel()
+		}
+		if err != nil {
+			step.Status = "failed"
+			step.Error = err.Error()
+			result.Results = append(result.Results, step)
+			result.Aborted = true
+
+			for _, skipped := range targets[i+1:] {
+				result.Results = append(result.Results, models.ContainerActionResult{
+					ID:     skipped.ID,
+					Name:   containerName(skipped),
+					Status: "skipped",
+				})
+			}
+			break
+		}
+
+		result.Results = append(result.Results, step)
+	}
+
+	return result, nil
+}
+
+// dryRunStatus is the status reported for containers a dry run would act on
+const dryRunStatus = "dry_run"
+
+// batchTarget is a container a batch operation acts on. A target with err
+// set is reported as failed without running the action.
+type batchTarget struct {
+	id   string
+	name string
+	err  error
+}
+
+func containerTargets(containers []types.Container) []batchTarget {
+	targets := make([]batchTarget, len(containers))
+	for i, c := range containers {
+		targets[i] = batchTarget{id: c.ID, name: containerName(c)}
+	}
+	return targets
+}
+
+// runBatch applies action to every target concurrently and reports the
+// result for each one. With dryRun set nothing is done and the targets are
+// reported with dryRunStatus, so destructive operations can be previewed.
+func runBatch(kind string, targets []batchTarget, status string, dryRun bool, action func(containerID string) error) []models.ContainerActionResult {
+	results := make([]models.ContainerActionResult, len(targets))
+
+	var batch *batchOperation
+	if !dryRun {
+		batch = startBatch(kind)
+		defer batch.finish()
+	}
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		result := models.ContainerActionResult{ID: target.id, Name: target.name, Status: status}
+		switch {
+		case target.err != nil:
+			result.Status = "failed"
+			result.Error = target.err.Error()
+		case dryRun:
+			result.Status = dryRunStatus
+		default:
+			batch.track(target.id)
+			wg.Add(1)
+			go func(i int, result models.ContainerActionResult) {
+				defer wg.Done()
+				if err := action(result.ID); err != nil {
+					result.Status = "failed"
+					result.Error = err.Error()
+				}
+				results[i] = result
+			}(i, result)
+			continue
+		}
+		results[i] = result
+	}
+	wg.Wait()
+
+	return results
+}
+
+// StopContainersByLabel stops every running container carrying label
+// concurrently and reports the result for each one
+func StopContainersByLabel(ctx context.Context, label string, dryRun bool) ([]models.ContainerActionResult, error) {
+	if strings.TrimSpace(label) == "" {
+		return nil, fmt.Errorf("label is required")
+	}
+
+	containers, err := listContainers(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", label)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return runBatch("stop-by-label", containerTargets(containers), "stopped", dryRun, func(containerID string) error {
+		return StopContainer(ctx, containerID, nil)
+	}), nil
+}
+
+// RemoveContainers removes several containers concurrently using the same
+// rules as RemoveContainer and reports the result for each one
+func RemoveContainers(ctx context.Context, containerIDs []string, force, removeVolumes, dryRun bool) ([]models.ContainerActionResult, error) {
+	if len(containerIDs) == 0 {
+		return nil, fmt.Errorf("at least one container is required")
+	}
+
+	inspectCtx, cancel := WithTimeout(ctx)
+	defer cancel()
+
+	targets := make([]batchTarget, len(containerIDs))
+	for i, containerID := range containerIDs {
+		target := batchTarget{id: containerID, name: containerID}
+		containerJSON, err := DockerClient(inspectCtx).ContainerInspect(inspectCtx, containerID)
+		if err != nil {
+			target.err = err
+		} else {
+			target.id = containerJSON.ID
+			target.name = strings.TrimPrefix(containerJSON.Name, "/")
+			// Checked up front so a dry run reports what would really fail
+			if !force && containerJSON.State != nil && containerJSON.State.Running {
+				target.err = fmt.Errorf("%w: stop it first or remove it with force=true", ErrContainerRunning)
+			}
+		}
+		targets[i] = target
+	}
+
+	return runBatch("batch-remove", targets, "removed", dryRun, func(containerID string) error {
+		return RemoveContainer(ctx, containerID, force, removeVolumes, false)
+	}), nil
+}
+
+// PruneContainers removes every stopped container and reports the result
+// for each one
+func PruneContainers(ctx context.Context, dryRun bool) ([]models.ContainerActionResult, error) {
+	containers, err := listContainers(ctx, types.ContainerListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("status", "created"),
+			filters.Arg("status", "exited"),
+			filters.Arg("status", "dead"),
+		),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return runBatch("prune", containerTargets(containers), "removed", dryRun, func(containerID string) error {
+		return RemoveContainer(ctx, containerID, false, false, false)
+	}), nil
+}
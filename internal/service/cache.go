@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"docker-manager/internal/models"
+
+	"github.com/docker/docker/api/types"
+	"golang.org/x/sync/singleflight"
+)
+
+// ttlCache is a small in-memory cache whose entries expire after ttl. A zero
+// ttl disables caching while still counting misses.
+type ttlCache struct {
+	name string
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	hits    uint64
+	misses  uint64
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+var (
+	cachesMu sync.Mutex
+	caches   []*ttlCache
+)
+
+func newTTLCache(name string) *ttlCache {
+	c := &ttlCache{name: name, entries: make(map[string]cacheEntry)}
+	cachesMu.Lock()
+	caches = append(caches, c)
+	cachesMu.Unlock()
+	return c
+}
+
+func (c *ttlCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if ok && time.Now().Before(entry.expires) {
+		c.hits++
+		return entry.value, true
+	}
+	if ok {
+		delete(c.entries, key)
+	}
+	c.misses++
+	return nil, false
+}
+
+func (c *ttlCache) set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl <= 0 {
+		return
+	}
+	c.entries[key] = cacheEntry{value: value, expires: time.Now().Add(c.ttl)}
+}
+
+func (c *ttlCache) clear() {
+	c.mu.Lock()
+	c.entries = make(map[string]cacheEntry)
+	c.mu.Unlock()
+}
+
+func (c *ttlCache) stats() models.CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return models.CacheStats{
+		Name:       c.name,
+		TTLSeconds: c.ttl.Seconds(),
+		Entries:    len(c.entries),
+		Hits:       c.hits,
+		Misses:     c.misses,
+	}
+}
+
+// Read caches for list and inspect calls. Control actions bypass them and
+// then invalidate the affected cache.
+var (
+	containerListCache    = newTTLCache("containers")
+	containerInspectCache = newTTLCache("container_inspect")
+	imageListCache        = newTTLCache("images")
+)
+
+// Caches for the dashboard's aggregate calls, which sweep the whole daemon
+// (DiskUsage in particular is slow). Concurrent misses share one call.
+var (
+	infoCache        = newTTLCache("info")
+	systemStatsCache = newTTLCache("system_stats")
+	infoFlight       singleflight.Group
+)
+
+// defaultInfoCacheTTL is how long info and system stats are reused unless
+// DOCKER_MANAGER_INFO_CACHE_TTL says otherwise
+const defaultInfoCacheTTL = 2 * time.Second
+
+// InitReadCache sets the TTL of the read caches from
+// DOCKER_MANAGER_READ_CACHE_TTL (e.g. "2s"), off when unset, and of the info
+// caches from DOCKER_MANAGER_INFO_CACHE_TTL, defaultInfoCacheTTL when unset
+func InitReadCache() error {
+	readTTL, err := cacheTTL("DOCKER_MANAGER_READ_CACHE_TTL", 0)
+	if err != nil {
+		return err
+	}
+	infoTTL, err := cacheTTL("DOCKER_MANAGER_INFO_CACHE_TTL", defaultInfoCacheTTL)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range []*ttlCache{containerListCache, containerInspectCache, imageListCache} {
+		c.setTTL(readTTL)
+	}
+	for _, c := range []*ttlCache{infoCache, systemStatsCache} {
+		c.setTTL(infoTTL)
+	}
+	return nil
+}
+
+// cacheTTL parses the duration in the environment variable name
+func cacheTTL(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative duration, got %q", name, value)
+	}
+	return ttl, nil
+}
+
+func (c *ttlCache) setTTL(ttl time.Duration) {
+	c.mu.Lock()
+	c.ttl = ttl
+	c.mu.Unlock()
+}
+
+// sharedCall returns the cached result of load for the host selected by ctx,
+// or runs load once for every concurrent caller. load runs detached from the
+// caller's cancellation since its result is shared.
+func sharedCall(ctx context.Context, c *ttlCache, key string, load func(context.Context) (interface{}, error)) (interface{}, error) {
+	key = hostScoped(ctx, key)
+	if value, ok := c.get(key); ok {
+		return value, nil
+	}
+
+	value, err, _ := infoFlight.Do(c.name+"/"+key, func() (interface{}, error) {
+		value, err := load(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		c.set(key, value)
+		return value, nil
+	})
+	return value, err
+}
+
+// GetCacheStats returns hit and miss counts for every cache
+func GetCacheStats() []models.CacheStats {
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+
+	stats := make([]models.CacheStats, 0, len(caches))
+	for _, c := range caches {
+		stats = append(stats, c.stats())
+	}
+	return stats
+}
+
+// invalidateContainerCaches drops cached container reads after a change
+func invalidateContainerCaches() {
+	containerListCache.clear()
+	containerInspectCache.clear()
+	infoCache.clear()
+	systemStatsCache.clear()
+}
+
+// invalidateImageCaches drops cached image reads after a change
+func invalidateImageCaches() {
+	imageListCache.clear()
+	infoCache.clear()
+	systemStatsCache.clear()
+}
+
+func cachedContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	encoded, _ := json.Marshal(options)
+	key := hostScoped(ctx, string(encoded))
+	if value, ok := containerListCache.get(key); ok {
+		return value.([]types.Container), nil
+	}
+
+	containers, err := DockerClient(ctx).ContainerList(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	containerListCache.set(key, containers)
+	return containers, nil
+}
+
+func cachedContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	key := hostScoped(ctx, containerID)
+	if value, ok := containerInspectCache.get(key); ok {
+		return value.(types.ContainerJSON), nil
+	}
+
+	containerJSON, err := DockerClient(ctx).ContainerInspect(ctx, containerID)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+	containerInspectCache.set(key, containerJSON)
+	return containerJSON, nil
+}
+
+func cachedImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error) {
+	encoded, _ := json.Marshal(options)
+	key := hostScoped(ctx, string(encoded))
+	if value, ok := imageListCache.get(key); ok {
+		return value.([]types.ImageSummary), nil
+	}
+
+	images, err := DockerClient(ctx).ImageList(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	imageListCache.set(key, images)
+	return images, nil
+}
@@ -0,0 +1,443 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"docker-manager/internal/models"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// Labels set by docker compose on the containers it creates
+const (
+	composeProjectLabel     = "com.docker.compose.project"
+	composeServiceLabel     = "com.docker.compose.service"
+	composeWorkingDirLabel  = "com.docker.compose.project.working_dir"
+	composeConfigFilesLabel = "com.docker.compose.project.config_files"
+)
+
+// maxComposeFileSize bounds how much of a compose file is returned
+const maxComposeFileSize = 1 << 20
+
+// composeValidateTimeout bounds how long `docker compose config` may run
+const composeValidateTimeout = 30 * time.Second
+
+// composeErrorLine extracts the line number from YAML parser errors such as
+// "yaml: line 5: mapping values are not allowed in this context"
+var composeErrorLine = regexp.MustCompile(`line (\d+)`)
+
+// ErrComposeFileTooLarge is returned for compose files over maxComposeFileSize
+var ErrComposeFileTooLarge = fmt.Errorf("compose file is larger than %d bytes", maxComposeFileSize)
+
+// ErrComposeProjectNotFound is returned when no container, or no running
+// container where that is required, belongs to a compose project
+var ErrComposeProjectNotFound = errors.New("compose project not found")
+
+// ErrNotComposeManaged is returned for containers not created by docker compose
+var ErrNotComposeManaged = errors.New("container is not managed by docker compose")
+
+// ErrComposeFileForbidden is returned when a container's labels point at a
+// file that isn't a YAML file inside the project's working directory. Anyone
+// able to create containers can set those labels.
+var ErrComposeFileForbidden = errors.New("compose file is outside the project working directory or not a YAML file")
+
+// GetContainerComposeFiles returns the contents of the compose files recorded
+// in a container's labels. The files are read from the local filesystem, so
+// files on another host or without read permission are reported per file.
+// Only .yml and .yaml files within the project's working directory are read,
+// anything else fails the whole request with ErrComposeFileForbidden.
+func GetContainerComposeFiles(ctx context.Context, containerID string) (*models.ContainerComposeFiles, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	containerJSON, err := cachedContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var labels map[string]string
+	if containerJSON.Config != nil {
+		labels = containerJSON.Config.Labels
+	}
+	if labels[composeConfigFilesLabel] == "" {
+		return nil, ErrNotComposeManaged
+	}
+
+	result := &models.ContainerComposeFiles{
+		Project:    labels[composeProjectLabel],
+		WorkingDir: labels[composeWorkingDirLabel],
+		Files:      []models.ComposeFile{},
+	}
+
+	var paths []string
+	for _, path := range strings.Split(labels[composeConfigFilesLabel], ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if !filepath.IsAbs(path) && result.WorkingDir != "" {
+			path = filepath.Join(result.WorkingDir, path)
+		}
+		if !composeFileAllowed(path, result.WorkingDir) {
+			return nil, fmt.Errorf("%w: %s", ErrComposeFileForbidden, path)
+		}
+		paths = append(paths, path)
+	}
+
+	for _, path := range paths {
+		file := models.ComposeFile{Path: path}
+		if content, err := readComposeFile(path); err != nil {
+			file.Error = err.Error()
+		} else {
+			file.Content = content
+		}
+		result.Files = append(result.Files, file)
+	}
+
+	return result, nil
+}
+
+// composeFileAllowed reports whether path is a YAML file within workingDir,
+// both as written and with symlinks resolved. Files that don't exist are
+// allowed so they can be reported as missing.
+func composeFileAllowed(path, workingDir string) bool {
+	if workingDir == "" || !filepath.IsAbs(workingDir) || !filepath.IsAbs(path) {
+		return false
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".yml" && ext != ".yaml" {
+		return false
+	}
+	if !inDirectory(path, workingDir) {
+		return false
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+	resolvedDir, err := filepath.EvalSymlinks(workingDir)
+	if err != nil {
+		return false
+	}
+	ext := strings.ToLower(filepath.Ext(resolved))
+	return (ext == ".yml" || ext == ".yaml") && inDirectory(resolved, resolvedDir)
+}
+
+// inDirectory reports whether path lies below dir
+func inDirectory(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func readComposeFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("file not found on this host (it may be on the machine that ran docker compose)")
+		}
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxComposeFileSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxComposeFileSize {
+		return "", fmt.Errorf("file is larger than %d bytes", maxComposeFileSize)
+	}
+	return string(data), nil
+}
+
+// ValidateComposeFile checks a compose file by running `docker compose config`
+// on it. An invalid file is not an error: the problems are reported in the
+// result. Relative paths in the file are resolved against the manager's
+// working directory.
+func ValidateComposeFile(ctx context.Context, content []byte) (*models.ComposeValidation, error) {
+	if len(content) > maxComposeFileSize {
+		return nil, ErrComposeFileTooLarge
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, composeValidateTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", "compose", "-f", "-", "config")
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("failed to run docker compose: %w", err)
+	}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("docker compose config timed out after %s", composeValidateTimeout)
+	}
+
+	result := &models.ComposeValidation{
+		Valid:  err == nil,
+		Errors: []models.ComposeValidationError{},
+	}
+	if result.Valid {
+		result.Config = stdout.String()
+		return result, nil
+	}
+
+	for _, line := range strings.Split(stderr.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		validationErr := models.ComposeValidationError{Message: line}
+		if match := composeErrorLine.FindStringSubmatch(line); match != nil {
+			validationErr.Line, _ = strconv.Atoi(match[1])
+		}
+		result.Errors = append(result.Errors, validationErr)
+	}
+	if len(result.Errors) == 0 {
+		result.Errors = append(result.Errors, models.ComposeValidationError{Message: exitErr.Error()})
+	}
+
+	return result, nil
+}
+
+// GetComposeProjects lists the containers created by docker compose, running
+// or not, grouped by project and service
+func GetComposeProjects(ctx context.Context) ([]models.ComposeProject, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	containers, err := cachedContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", composeProjectLabel)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	projects := make(map[string]*models.ComposeProject)
+	services := make(map[string]map[string]*models.ComposeService)
+	for _, c := range containers {
+		name := c.Labels[composeProjectLabel]
+		project, ok := projects[name]
+		if !ok {
+			project = &models.ComposeProject{Name: name, WorkingDir: c.Labels[composeWorkingDirLabel]}
+			projects[name] = project
+			services[name] = make(map[string]*models.ComposeService)
+		}
+
+		serviceName := c.Labels[composeServiceLabel]
+		service, ok := services[name][serviceName]
+		if !ok {
+			service = &models.ComposeService{Name: serviceName}
+			services[name][serviceName] = service
+		}
+
+		service.Containers = append(service.Containers, models.ComposeContainer{
+			ID:     c.ID,
+			Name:   containerName(c),
+			State:  c.State,
+			Status: c.Status,
+		})
+		service.Total++
+		project.Total++
+		if c.State == "running" {
+			service.Running++
+			project.Running++
+		}
+	}
+
+	result := make([]models.ComposeProject, 0, len(projects))
+	for name, project := range projects {
+		project.Services = []models.ComposeService{}
+		for _, service := range services[name] {
+			sort.Slice(service.Containers, func(i, j int) bool {
+				return service.Containers[i].Name < service.Containers[j].Name
+			})
+			project.Services = append(project.Services, *service)
+		}
+		sort.Slice(project.Services, func(i, j int) bool {
+			return project.Services[i].Name < project.Services[j].Name
+		})
+
+		switch project.Running {
+		case project.Total:
+			project.Status = "running"
+		case 0:
+			project.Status = "stopped"
+		default:
+			project.Status = "partial"
+		}
+		result = append(result, *project)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// projectContainers returns every container of a compose project in start
+// order, by service and then by name
+func projectContainers(ctx context.Context, project string) ([]types.Container, error) {
+	containers, err := listContainers(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", composeProjectLabel+"="+project)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrComposeProjectNotFound, project)
+	}
+
+	sort.Slice(containers, func(i, j int) bool {
+		si, sj := containers[i].Labels[composeServiceLabel], containers[j].Labels[composeServiceLabel]
+		if si != sj {
+			return si < sj
+		}
+		return containerName(containers[i]) < containerName(containers[j])
+	})
+	return containers, nil
+}
+
+// ComposeProjectUp starts the containers of a compose project one at a time
+// and reports the result for each one. depends_on isn't taken into account,
+// a failed container doesn't stop the rest from being started.
+func ComposeProjectUp(ctx context.Context, project string) ([]models.ContainerActionResult, error) {
+	containers, err := projectContainers(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	return runInOrder("compose-up", containers, "started", false, func(containerID string) error {
+		return StartContainer(ctx, containerID)
+	}), nil
+}
+
+// ComposeProjectDown stops the containers of a compose project in the reverse
+// of the order ComposeProjectUp starts them and reports the result for each
+// one. With dryRun set the containers are only listed.
+func ComposeProjectDown(ctx context.Context, project string, dryRun bool) ([]models.ContainerActionResult, error) {
+	containers, err := projectContainers(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(containers)
+	return runInOrder("compose-down", containers, "stopped", dryRun, func(containerID string) error {
+		return StopContainer(ctx, containerID, nil)
+	}), nil
+}
+
+// runInOrder applies action to containers one after another, unlike runBatch.
+// With dryRun set the containers are reported with dryRunStatus instead.
+func runInOrder(kind string, containers []types.Container, status string, dryRun bool, action func(containerID string) error) []models.ContainerActionResult {
+	results := make([]models.ContainerActionResult, 0, len(containers))
+	if dryRun {
+		for _, c := range containers {
+			results = append(results, models.ContainerActionResult{ID: c.ID, Name: containerName(c), Status: dryRunStatus})
+		}
+		return results
+	}
+
+	batch := startBatch(kind)
+	defer batch.finish()
+
+	for _, c := range containers {
+		result := models.ContainerActionResult{ID: c.ID, Name: containerName(c), Status: status}
+		batch.track(c.ID)
+		if err := action(c.ID); err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// GetComposeProjectStats sums the CPU, memory and network usage of the
+// running containers of a compose project, fetching their stats concurrently
+func GetComposeProjectStats(ctx context.Context, project string) (*models.ComposeProjectStats, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	containers, err := DockerClient(ctx).ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", composeProjectLabel+"="+project)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("%w: %s has no running containers", ErrComposeProjectNotFound, project)
+	}
+
+	samples := make([]*types.StatsJSON, len(containers))
+	errs := make([]error, len(containers))
+	var wg sync.WaitGroup
+	for i, c := range containers {
+		wg.Add(1)
+		go func(i int, containerID string) {
+			defer wg.Done()
+			samples[i], errs[i] = containerStatsOnce(ctx, containerID)
+		}(i, c.ID)
+	}
+	wg.Wait()
+
+	result := &models.ComposeProjectStats{Project: project, Services: []models.ComposeServiceStats{}}
+	services := make(map[string]*models.ResourceTotals)
+	var names []string
+	for i, c := range containers {
+		if errs[i] != nil {
+			result.Errors = append(result.Errors, models.ContainerActionResult{
+				ID:     c.ID,
+				Name:   containerName(c),
+				Status: "failed",
+				Error:  errs[i].Error(),
+			})
+			continue
+		}
+
+		service := c.Labels[composeServiceLabel]
+		totals, ok := services[service]
+		if !ok {
+			totals = &models.ResourceTotals{}
+			services[service] = totals
+			names = append(names, service)
+		}
+		addResourceUsage(totals, samples[i])
+		addResourceUsage(&result.Total, samples[i])
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		result.Services = append(result.Services, models.ComposeServiceStats{Service: name, ResourceTotals: *services[name]})
+	}
+
+	return result, nil
+}
+
+func addResourceUsage(totals *models.ResourceTotals, stats *types.StatsJSON) {
+	totals.Containers++
+	totals.CPUPercent += cpuPercent(stats)
+	totals.MemoryUsage += memoryUsage(stats)
+	for _, network := range stats.Networks {
+		totals.NetworkRx += network.RxBytes
+		totals.NetworkTx += network.TxBytes
+	}
+}
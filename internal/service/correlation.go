@@ -0,0 +1,110 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+// BatchAttribute is the event actor attribute naming the manager batch
+// operation that caused an event
+const BatchAttribute = "docker-manager.batch"
+
+// batchEventGrace is how long after a batch operation finishes its events
+// are still attributed to it, since the daemon reports them asynchronously
+const batchEventGrace = 5 * time.Second
+
+// batchOperation records the containers touched by a manager-initiated batch
+// operation so the Docker events they produce can be recognised
+type batchOperation struct {
+	id         string
+	started    time.Time
+	ended      time.Time
+	containers map[string]bool
+}
+
+var (
+	batchesMu sync.Mutex
+	batches   = make(map[string]*batchOperation)
+)
+
+// startBatch registers a new batch operation of the given kind
+func startBatch(kind string) *batchOperation {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	batch := &batchOperation{
+		id:         kind + "-" + hex.EncodeToString(suffix),
+		started:    time.Now(),
+		containers: make(map[string]bool),
+	}
+
+	batchesMu.Lock()
+	batches[batch.id] = batch
+	batchesMu.Unlock()
+	return batch
+}
+
+// track attributes events of a container to the batch. Must be called
+// before acting on the container.
+func (b *batchOperation) track(containerID string) {
+	batchesMu.Lock()
+	b.containers[containerID] = true
+	batchesMu.Unlock()
+}
+
+// finish marks the batch as done. Its events are still recognised for
+// batchEventGrace so late events aren't missed.
+func (b *batchOperation) finish() {
+	batchesMu.Lock()
+	b.ended = time.Now()
+	batchesMu.Unlock()
+
+	time.AfterFunc(batchEventGrace, func() {
+		batchesMu.Lock()
+		delete(batches, b.id)
+		batchesMu.Unlock()
+	})
+}
+
+// EventBatch returns the ID of the batch operation that caused an event, or
+// an empty string if the event wasn't caused by one
+func EventBatch(event events.Message) string {
+	if event.Type != events.ContainerEventType {
+		return ""
+	}
+	eventTime := time.Unix(0, event.TimeNano)
+
+	batchesMu.Lock()
+	defer batchesMu.Unlock()
+
+	for _, batch := range batches {
+		if !batch.containers[event.Actor.ID] || eventTime.Before(batch.started) {
+			continue
+		}
+		if batch.ended.IsZero() || eventTime.Before(batch.ended.Add(batchEventGrace)) {
+			return batch.id
+		}
+	}
+	return ""
+}
+
+// TagBatchEvent sets BatchAttribute on an event caused by a batch operation
+// and reports whether it did
+func TagBatchEvent(event *events.Message) bool {
+	id := EventBatch(*event)
+	if id == "" {
+		return false
+	}
+
+	attributes := make(map[string]string, len(event.Actor.Attributes)+1)
+	for k, v := range event.Actor.Attributes {
+		attributes[k] = v
+	}
+	attributes[BatchAttribute] = id
+	event.Actor.Attributes = attributes
+	return true
+}
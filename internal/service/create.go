@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"docker-manager/internal/models"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+// ErrInvalidContainerSpec is returned when a create request can't be turned
+// into a container configuration
+var ErrInvalidContainerSpec = errors.New("invalid container spec")
+
+// ErrImageNotFound is returned when creating a container from an image that
+// isn't present locally and pulling wasn't requested
+var ErrImageNotFound = errors.New("image not found locally")
+
+// CreateContainer creates (but doesn't start) a container. When req.Pull is
+// set the image is pulled first, otherwise it must already be present.
+func CreateContainer(ctx context.Context, req models.ContainerCreateRequest) (*models.ContainerCreateResult, error) {
+	if strings.TrimSpace(req.Image) == "" {
+		return nil, fmt.Errorf("%w: image is required", ErrInvalidContainerSpec)
+	}
+
+	exposedPorts, portBindings, err := nat.ParsePortSpecs(req.Ports)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidContainerSpec, err)
+	}
+
+	restartPolicy, err := parseRestartPolicy(req.RestartPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, env := range req.Env {
+		if key, _, _ := strings.Cut(env, "="); key == "" {
+			return nil, fmt.Errorf("%w: environment variable %q has no name", ErrInvalidContainerSpec, env)
+		}
+	}
+
+	if req.Pull {
+		if err := PullImage(ctx, req.Image, "", nil); err != nil {
+			return nil, fmt.Errorf("failed to pull %s: %w", req.Image, err)
+		}
+		invalidateImageCaches()
+	}
+
+	config := &container.Config{
+		Image:        req.Image,
+		Env:          req.Env,
+		ExposedPorts: exposedPorts,
+	}
+	hostConfig := &container.HostConfig{
+		PortBindings:  portBindings,
+		RestartPolicy: restartPolicy,
+	}
+
+	// Pulling may take much longer, so only the create call is bounded
+	createCtx, cancel := WithTimeout(ctx)
+	defer cancel()
+	response, err := DockerClient(createCtx).ContainerCreate(createCtx, config, hostConfig, nil, nil, req.Name)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, fmt.Errorf("%w: %s (set pull to pull it first)", ErrImageNotFound, req.Image)
+		}
+		return nil, err
+	}
+	invalidateContainerCaches()
+
+	return &models.ContainerCreateResult{ID: response.ID, Warnings: response.Warnings}, nil
+}
+
+// parseRestartPolicy parses a policy in the form accepted by `docker run --restart`
+func parseRestartPolicy(policy string) (container.RestartPolicy, error) {
+	name, retries, hasRetries := strings.Cut(policy, ":")
+
+	switch name {
+	case "", "no", "always", "unless-stopped":
+		if hasRetries {
+			return container.RestartPolicy{}, fmt.Errorf("%w: restart policy %q doesn't take a retry count", ErrInvalidContainerSpec, name)
+		}
+		return container.RestartPolicy{Name: name}, nil
+	case "on-failure":
+		result := container.RestartPolicy{Name: name}
+		if hasRetries {
+			count, err := strconv.Atoi(retries)
+			if err != nil || count < 0 {
+				return container.RestartPolicy{}, fmt.Errorf("%w: invalid retry count %q", ErrInvalidContainerSpec, retries)
+			}
+			result.MaximumRetryCount = count
+		}
+		return result, nil
+	default:
+		return container.RestartPolicy{}, fmt.Errorf("%w: unknown restart policy %q", ErrInvalidContainerSpec, name)
+	}
+}
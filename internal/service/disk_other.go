@@ -0,0 +1,10 @@
+//go:build !unix
+
+package service
+
+import "errors"
+
+// filesystemUsage is not implemented without statfs
+func filesystemUsage(path string) (total, available uint64, err error) {
+	return 0, 0, errors.New("filesystem usage is not supported on this platform")
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package service
+
+import "syscall"
+
+// filesystemUsage returns the total and available bytes of the filesystem
+// holding path. Available excludes blocks reserved for root, like df.
+func filesystemUsage(path string) (total, available uint64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	return uint64(stat.Blocks) * uint64(stat.Bsize), uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
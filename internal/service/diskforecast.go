@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"docker-manager/internal/models"
+)
+
+// How often filesystem usage is sampled and how many samples are kept
+const (
+	diskSampleInterval = 5 * time.Minute
+	diskHistorySize    = 288 // 24 hours
+)
+
+// diskSample is the used space of a filesystem at a point in time
+type diskSample struct {
+	time time.Time
+	used uint64
+}
+
+// diskHistory keeps recent usage samples of the filesystems being forecast
+type diskHistory struct {
+	mu         sync.Mutex
+	dockerRoot string
+	samples    map[string][]diskSample
+}
+
+var recordedDisk = &diskHistory{samples: make(map[string][]diskSample)}
+
+// dockerRootDir returns the data root of the primary Docker host, which is
+// the one running on this machine, or "" when the daemon can't be reached
+func (h *diskHistory) dockerRootDir(ctx context.Context) string {
+	h.mu.Lock()
+	dockerRoot := h.dockerRoot
+	h.mu.Unlock()
+	if dockerRoot != "" {
+		return dockerRoot
+	}
+
+	ctx, _ = WithHost(ctx, primaryHostID)
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	info, err := DockerClient(ctx).Info(ctx)
+	if err != nil {
+		return ""
+	}
+	h.mu.Lock()
+	h.dockerRoot = info.DockerRootDir
+	h.mu.Unlock()
+	return info.DockerRootDir
+}
+
+// paths returns the filesystems to sample, labelled by what they hold
+func (h *diskHistory) paths(ctx context.Context) map[string]string {
+	dockerRoot := h.dockerRootDir(ctx)
+
+	paths := map[string]string{"root": "/"}
+	if dockerRoot != "" {
+		paths["docker_root"] = dockerRoot
+	}
+	return paths
+}
+
+func (h *diskHistory) sample(ctx context.Context) {
+	now := time.Now()
+	for _, path := range h.paths(ctx) {
+		total, available, err := filesystemUsage(path)
+		if err != nil {
+			continue
+		}
+
+		h.mu.Lock()
+		ring := append(h.samples[path], diskSample{time: now, used: total - available})
+		if len(ring) > diskHistorySize {
+			ring = ring[len(ring)-diskHistorySize:]
+		}
+		h.samples[path] = ring
+		h.mu.Unlock()
+	}
+}
+
+func (h *diskHistory) history(path string) []diskSample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]diskSample(nil), h.samples[path]...)
+}
+
+// StartDiskHistory samples filesystem usage in the background until ctx is
+// cancelled, so disk growth can be forecast
+func StartDiskHistory(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(diskSampleInterval)
+		defer ticker.Stop()
+
+		for {
+			recordedDisk.sample(ctx)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// GetDiskForecast returns the current usage of the root filesystem and the
+// Docker data root, their growth rate over the recorded history and how long
+// until they are full at that rate. The filesystems are those of this
+// machine, so only the primary host has a forecast.
+func GetDiskForecast(ctx context.Context) ([]models.DiskForecast, error) {
+	if hostID := HostID(ctx); hostID != primaryHostID {
+		return nil, fmt.Errorf("%w: disk forecast requested for %s", ErrPrimaryHostOnly, hostID)
+	}
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	paths := recordedDisk.paths(ctx)
+
+	forecasts := []models.DiskForecast{}
+	for _, label := range []string{"docker_root", "root"} {
+		path, ok := paths[label]
+		if !ok {
+			continue
+		}
+
+		forecast := models.DiskForecast{Label: label, Path: path}
+		total, available, err := filesystemUsage(path)
+		if err != nil {
+			forecast.Error = err.Error()
+			forecasts = append(forecasts, forecast)
+			continue
+		}
+		forecast.Total = total
+		forecast.Used = total - available
+		forecast.Available = available
+		if total > 0 {
+			forecast.UsedPercent = float64(forecast.Used) / float64(total) * 100
+		}
+
+		samples := recordedDisk.history(path)
+		forecast.Samples = len(samples)
+		if rate, ok := growthPerHour(samples); ok {
+			forecast.GrowthBytesPerHour = &rate
+			if rate > 0 {
+				hours := float64(available) / rate
+				forecast.HoursUntilFull = &hours
+			}
+		}
+
+		forecasts = append(forecasts, forecast)
+	}
+
+	return forecasts, nil
+}
+
+// growthPerHour fits a least-squares line through the samples and returns
+// its slope in bytes per hour. It needs at least two samples at different
+// times.
+func growthPerHour(samples []diskSample) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+
+	// Times are taken relative to the first sample and sizes relative to
+	// its size, in integers, so the sums stay small enough for float64 to
+	// keep the precision of byte counts. Both are then centered on their
+	// means, which leaves the slope unchanged.
+	start, base := samples[0].time, samples[0].used
+	xs := make([]float64, len(samples))
+	ys := make([]float64, len(samples))
+	var meanX, meanY float64
+	for i, s := range samples {
+		xs[i] = s.time.Sub(start).Hours()
+		ys[i] = float64(int64(s.used - base))
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	n := float64(len(samples))
+	meanX /= n
+	meanY /= n
+
+	var sumXY, sumXX float64
+	for i := range samples {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		sumXY += dx * dy
+		sumXX += dx * dx
+	}
+	if sumXX == 0 {
+		return 0, false
+	}
+	return sumXY / sumXX, true
+}
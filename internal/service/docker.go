@@ -3,104 +3,269 @@ package service
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"docker-manager/internal/models"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/volume"
-	"github.com/docker/docker/client"
-	"github.com/gorilla/websocket"
 )
 
-var DockerClient *client.Client
-var Upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+// StopTimeout is the default number of seconds to wait for a container to
+// stop before it is killed
+var StopTimeout = 10
+
+// InitStopTimeout sets StopTimeout from DOCKER_MANAGER_STOP_TIMEOUT
+func InitStopTimeout() error {
+	value := os.Getenv("DOCKER_MANAGER_STOP_TIMEOUT")
+	if value == "" {
+		return nil
+	}
+
+	timeout, err := strconv.Atoi(value)
+	if err != nil || timeout < 0 {
+		return fmt.Errorf("DOCKER_MANAGER_STOP_TIMEOUT must be a non-negative integer, got %q", value)
+	}
+	StopTimeout = timeout
+	return nil
 }
 
-func InitDockerClient() {
-	var err error
-	DockerClient, err = client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		log.Fatal("Failed to create Docker client:", err)
+// RequestTimeout bounds how long a single Docker API call may take, so a hung
+// daemon doesn't hang requests forever
+var RequestTimeout = 30 * time.Second
+
+// WithTimeout bounds ctx by RequestTimeout
+func WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, RequestTimeout)
+}
+
+// withStopTimeout bounds ctx by RequestTimeout on top of the seconds a
+// container is given to stop, since the daemon waits that long before killing it
+func withStopTimeout(ctx context.Context, timeout int) (context.Context, context.CancelFunc) {
+	if timeout < 0 {
+		// Wait indefinitely for the container to stop
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, RequestTimeout+time.Duration(timeout)*time.Second)
 }
 
 // Logic functions that use the docker client
 
-func GetDockerInfo() (*models.DockerInfo, error) {
-	ctx := context.Background()
-
-	info, err := DockerClient.Info(ctx)
+// GetDockerInfo returns an overview of the daemon, reusing a result younger
+// than the info cache TTL
+func GetDockerInfo(ctx context.Context) (*models.DockerInfo, error) {
+	value, err := sharedCall(ctx, infoCache, "info", func(ctx context.Context) (interface{}, error) {
+		return loadDockerInfo(ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
+	return value.(*models.DockerInfo), nil
+}
 
-	version, err := DockerClient.ServerVersion(ctx)
-	if err != nil {
-		return nil, err
+func loadDockerInfo(ctx context.Context) (*models.DockerInfo, error) {
+	// The first failure cancels the remaining calls, DiskUsage in particular
+	// can take a while on hosts with many images
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		result   models.DockerInfo
+	)
+	run := func(call func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := call(); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}()
 	}
 
-	containers, err := DockerClient.ContainerList(ctx, types.ContainerListOptions{All: true})
-	if err != nil {
-		return nil, err
+	run(func() error {
+		info, err := DockerClient(ctx).Info(ctx)
+		result.SystemInfo = &info
+		return err
+	})
+	run(func() (err error) {
+		result.Version, err = DockerClient(ctx).ServerVersion(ctx)
+		return err
+	})
+	run(func() (err error) {
+		result.Containers, err = DockerClient(ctx).ContainerList(ctx, types.ContainerListOptions{All: true})
+		return err
+	})
+	run(func() (err error) {
+		result.Images, err = DockerClient(ctx).ImageList(ctx, types.ImageListOptions{All: true})
+		return err
+	})
+	run(func() (err error) {
+		result.Networks, err = DockerClient(ctx).NetworkList(ctx, types.NetworkListOptions{})
+		return err
+	})
+	run(func() (err error) {
+		result.Volumes, err = DockerClient(ctx).VolumeList(ctx, volume.ListOptions{})
+		return err
+	})
+	run(func() (err error) {
+		result.DiskUsage, err = DockerClient(ctx).DiskUsage(ctx, types.DiskUsageOptions{})
+		return err
+	})
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
 	}
+	result.HostID = HostID(ctx)
+	return &result, nil
+}
 
-	images, err := DockerClient.ImageList(ctx, types.ImageListOptions{All: true})
+// GetRegistryConfig returns the registry mirrors, insecure registries and
+// per-registry settings the daemon reports in its info
+func GetRegistryConfig(ctx context.Context) (*models.RegistryConfig, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	info, err := DockerClient(ctx).Info(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	networks, err := DockerClient.NetworkList(ctx, types.NetworkListOptions{})
+	config := &models.RegistryConfig{
+		Mirrors:            []string{},
+		InsecureRegistries: []string{},
+		Indexes:            []models.RegistryIndex{},
+	}
+	if info.RegistryConfig == nil {
+		return config, nil
+	}
+
+	config.Mirrors = append(config.Mirrors, info.RegistryConfig.Mirrors...)
+	for _, cidr := range info.RegistryConfig.InsecureRegistryCIDRs {
+		config.InsecureRegistries = append(config.InsecureRegistries, cidr.String())
+	}
+	for _, index := range info.RegistryConfig.IndexConfigs {
+		if !index.Secure {
+			config.InsecureRegistries = append(config.InsecureRegistries, index.Name)
+		}
+		mirrors := index.Mirrors
+		if mirrors == nil {
+			mirrors = []string{}
+		}
+		config.Indexes = append(config.Indexes, models.RegistryIndex{
+			Name:     index.Name,
+			Mirrors:  mirrors,
+			Secure:   index.Secure,
+			Official: index.Official,
+		})
+	}
+	sort.Slice(config.Indexes, func(i, j int) bool {
+		return config.Indexes[i].Name < config.Indexes[j].Name
+	})
+
+	return config, nil
+}
+
+// GetTimeline returns the containers and images created within the last
+// window, oldest first
+func GetTimeline(ctx context.Context, window time.Duration) ([]models.TimelineEvent, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	cutoff := time.Now().Add(-window).Unix()
+
+	containers, err := cachedContainerList(ctx, types.ContainerListOptions{All: true})
 	if err != nil {
 		return nil, err
 	}
 
-	volumes, err := DockerClient.VolumeList(ctx, volume.ListOptions{})
+	images, err := cachedImageList(ctx, types.ImageListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	diskUsage, err := DockerClient.DiskUsage(ctx, types.DiskUsageOptions{})
+	timeline := []models.TimelineEvent{}
+	for _, c := range containers {
+		if c.Created < cutoff {
+			continue
+		}
+		timeline = append(timeline, models.TimelineEvent{
+			Time: time.Unix(c.Created, 0).UTC(),
+			Type: "container",
+			ID:   c.ID,
+			Name: containerName(c),
+		})
+	}
+	for _, img := range images {
+		if img.Created < cutoff {
+			continue
+		}
+		name := img.ID
+		if len(img.RepoTags) > 0 && img.RepoTags[0] != "<none>:<none>" {
+			name = img.RepoTags[0]
+		}
+		timeline = append(timeline, models.TimelineEvent{
+			Time: time.Unix(img.Created, 0).UTC(),
+			Type: "image",
+			ID:   img.ID,
+			Name: name,
+		})
+	}
+
+	sort.Slice(timeline, func(i, j int) bool {
+		return timeline[i].Time.Before(timeline[j].Time)
+	})
+
+	return timeline, nil
+}
+
+// GetSystemStats counts containers, images, networks and volumes, reusing a
+// result younger than the info cache TTL
+func GetSystemStats(ctx context.Context) (*models.SystemStats, error) {
+	value, err := sharedCall(ctx, systemStatsCache, "stats", func(ctx context.Context) (interface{}, error) {
+		return loadSystemStats(ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	return &models.DockerInfo{
-		SystemInfo: &info,
-		Version:    version,
-		Containers: containers,
-		Images:     images,
-		Networks:   networks,
-		Volumes:    volumes,
-		DiskUsage:  diskUsage,
-	}, nil
+	return value.(*models.SystemStats), nil
 }
 
-func GetSystemStats() (*models.SystemStats, error) {
-	ctx := context.Background()
+func loadSystemStats(ctx context.Context) (*models.SystemStats, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
 
-	containers, err := DockerClient.ContainerList(ctx, types.ContainerListOptions{All: true})
+	containers, err := cachedContainerList(ctx, types.ContainerListOptions{All: true})
 	if err != nil {
 		return nil, err
 	}
 
-	images, err := DockerClient.ImageList(ctx, types.ImageListOptions{All: true})
+	images, err := cachedImageList(ctx, types.ImageListOptions{All: true})
 	if err != nil {
 		return nil, err
 	}
 
-	networks, err := DockerClient.NetworkList(ctx, types.NetworkListOptions{})
+	networks, err := DockerClient(ctx).NetworkList(ctx, types.NetworkListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	volumes, err := DockerClient.VolumeList(ctx, volume.ListOptions{})
+	volumes, err := DockerClient(ctx).VolumeList(ctx, volume.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -129,50 +294,526 @@ func GetSystemStats() (*models.SystemStats, error) {
 	return stats, nil
 }
 
-func GetContainerDetail(containerID string) (*models.ContainerDetail, error) {
-	ctx := context.Background()
-	containerJSON, err := DockerClient.ContainerInspect(ctx, containerID)
+// ListContainers lists all containers, running or not, matching args
+func ListContainers(ctx context.Context, args filters.Args) ([]types.Container, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	return cachedContainerList(ctx, types.ContainerListOptions{All: true, Filters: args})
+}
+
+// GetContainerSummaries lists the containers matching args enriched with
+// fields that are only available from inspect, such as whether they are
+// removed on exit
+func GetContainerSummaries(ctx context.Context, args filters.Args) ([]models.ContainerSummary, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+
+	containers, err := ListContainers(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]models.ContainerSummary, 0, len(containers))
+	for _, c := range containers {
+		summary := models.ContainerSummary{Container: c}
+		if containerJSON, err := cachedContainerInspect(ctx, c.ID); err == nil {
+			if containerJSON.HostConfig != nil {
+				summary.AutoRemove = containerJSON.HostConfig.AutoRemove
+			}
+			if containerJSON.State != nil && containerJSON.State.Health != nil {
+				summary.Health = containerJSON.State.Health.Status
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, nil
+}
+
+// GetOrphanedContainers returns the containers whose image ID is no longer
+// present in the local image list. Such containers fail to start.
+func GetOrphanedContainers(ctx context.Context) ([]models.OrphanedContainer, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+
+	containers, err := cachedContainerList(ctx, types.ContainerListOptions{All: true})
 	if err != nil {
 		return nil, err
 	}
 
+	images, err := cachedImageList(ctx, types.ImageListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+
+	imageIDs := make(map[string]bool, len(images))
+	for _, img := range images {
+		imageIDs[img.ID] = true
+	}
+
+	orphaned := []models.OrphanedContainer{}
+	for _, c := range containers {
+		if imageIDs[c.ImageID] {
+			continue
+		}
+		orphaned = append(orphaned, models.OrphanedContainer{
+			ID:       c.ID,
+			Name:     containerName(c),
+			Image:    c.Image,
+			ImageID:  c.ImageID,
+			State:    c.State,
+			Orphaned: true,
+		})
+	}
+
+	return orphaned, nil
+}
+
+// GetContainerDetail returns the inspect result of a container along with its
+// stats and note. Secret environment variables are masked unless rawEnv is set.
+func GetContainerDetail(ctx context.Context, containerID string, rawEnv bool) (*models.ContainerDetail, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	containerJSON, err := cachedContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := cacheContainerLimits(ctx, containerJSON)
+	if !rawEnv {
+		containerJSON = redactContainerEnv(containerJSON)
+	}
+
 	detail := &models.ContainerDetail{
-		Container: containerJSON,
+		Container:  containerJSON,
+		StopSignal: defaultStopSignal,
+	}
+	if containerJSON.Config != nil && containerJSON.Config.StopSignal != "" {
+		detail.StopSignal = containerJSON.Config.StopSignal
+	}
+	if containerJSON.HostConfig != nil {
+		detail.AutoRemove = containerJSON.HostConfig.AutoRemove
+	}
+	detail.Note = getContainerNote(containerJSON.ID)
+	if containerJSON.State != nil && containerJSON.State.Health != nil {
+		detail.Health = containerHealth(containerJSON.State.Health, detailHealthLogSize)
 	}
 
 	// Get stats if container is running
 	if containerJSON.State.Running {
-		stats, err := DockerClient.ContainerStats(ctx, containerID, false)
-		if err == nil {
-			var statsJSON types.StatsJSON
-			if err := json.NewDecoder(stats.Body).Decode(&statsJSON); err == nil {
-				detail.Stats = &statsJSON
-			}
-			stats.Body.Close()
+		if statsJSON, err := containerStatsOnce(ctx, containerID); err == nil {
+			detail.Stats = statsJSON
+			detail.ComputedStats = computeStats(statsJSON)
+			detail.Usage = computeContainerUsage(ctx, limits, statsJSON)
 		}
 	}
 	return detail, nil
 }
 
-func StartContainer(containerID string) error {
-	ctx := context.Background()
-	return DockerClient.ContainerStart(ctx, containerID, types.ContainerStartOptions{})
+// detailHealthLogSize is how many healthcheck results the container detail includes
+const detailHealthLogSize = 3
+
+// containerHealth converts a healthcheck state, keeping at most the last
+// maxLog results when maxLog is positive
+func containerHealth(health *types.Health, maxLog int) *models.ContainerHealth {
+	results := health.Log
+	if maxLog > 0 && len(results) > maxLog {
+		results = results[len(results)-maxLog:]
+	}
+
+	result := &models.ContainerHealth{
+		Status:        health.Status,
+		FailingStreak: health.FailingStreak,
+		Log:           make([]models.HealthCheckResult, 0, len(results)),
+	}
+	for _, check := range results {
+		result.Log = append(result.Log, models.HealthCheckResult{
+			Start:    check.Start,
+			End:      check.End,
+			ExitCode: check.ExitCode,
+			Output:   check.Output,
+		})
+	}
+	return result
+}
+
+// GetContainerHealth returns the healthcheck state of a container with every
+// result Docker has kept. The container is inspected directly since the
+// cached inspect would lag behind new results.
+func GetContainerHealth(ctx context.Context, containerID string) (*models.ContainerHealth, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	containerJSON, err := DockerClient(ctx).ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if containerJSON.State == nil || containerJSON.State.Health == nil {
+		return &models.ContainerHealth{Status: types.NoHealthcheck, Log: []models.HealthCheckResult{}}, nil
+	}
+	return containerHealth(containerJSON.State.Health, 0), nil
+}
+
+// GetNetwork returns a network with its attached containers and IPAM
+// configuration. Verbose also includes swarm service attachments.
+func GetNetwork(ctx context.Context, networkID string) (types.NetworkResource, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	return DockerClient(ctx).NetworkInspect(ctx, networkID, types.NetworkInspectOptions{Verbose: true})
+}
+
+// GetContainerPorts returns the exposed ports of a container with one entry
+// per host binding, ordered by port. Ports that aren't published have no
+// host address.
+func GetContainerPorts(ctx context.Context, containerID string) ([]models.PortMapping, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	containerJSON, err := cachedContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	ports := []models.PortMapping{}
+	if containerJSON.NetworkSettings == nil {
+		return ports, nil
+	}
+	for port, bindings := range containerJSON.NetworkSettings.Ports {
+		mapping := models.PortMapping{ContainerPort: port.Int(), Protocol: port.Proto()}
+		if len(bindings) == 0 {
+			ports = append(ports, mapping)
+			continue
+		}
+		for _, binding := range bindings {
+			mapping.HostIP = binding.HostIP
+			mapping.HostPort = binding.HostPort
+			ports = append(ports, mapping)
+		}
+	}
+
+	sort.Slice(ports, func(i, j int) bool {
+		a, b := ports[i], ports[j]
+		if a.ContainerPort != b.ContainerPort {
+			return a.ContainerPort < b.ContainerPort
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		return a.HostIP < b.HostIP
+	})
+	return ports, nil
+}
+
+// GetContainerMounts returns the effective mounts of a container, including
+// tmpfs mounts which inspect only reports in the host config
+func GetContainerMounts(ctx context.Context, containerID string) ([]models.ContainerMount, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	containerJSON, err := cachedContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Propagation for binds created with --mount is only recorded in the host config
+	bindPropagation := make(map[string]string)
+	if containerJSON.HostConfig != nil {
+		for _, m := range containerJSON.HostConfig.Mounts {
+			if m.BindOptions != nil && m.BindOptions.Propagation != "" {
+				bindPropagation[m.Target] = string(m.BindOptions.Propagation)
+			}
+		}
+	}
+
+	mounts := make([]models.ContainerMount, 0, len(containerJSON.Mounts))
+	for _, m := range containerJSON.Mounts {
+		propagation := string(m.Propagation)
+		if propagation == "" {
+			propagation = bindPropagation[m.Destination]
+		}
+		mounts = append(mounts, models.ContainerMount{
+			Type:        string(m.Type),
+			Name:        m.Name,
+			Source:      m.Source,
+			Destination: m.Destination,
+			Driver:      m.Driver,
+			Mode:        m.Mode,
+			ReadOnly:    !m.RW,
+			Propagation: propagation,
+		})
+	}
+
+	if containerJSON.HostConfig != nil {
+		for destination, options := range containerJSON.HostConfig.Tmpfs {
+			mounts = append(mounts, models.ContainerMount{
+				Type:        "tmpfs",
+				Destination: destination,
+				Mode:        options,
+				ReadOnly:    strings.Contains(","+options+",", ",ro,"),
+			})
+		}
+	}
+
+	return mounts, nil
+}
+
+// GetContainerNamespaces returns the namespace modes of a container,
+// resolving namespaces shared with other containers to their names
+func GetContainerNamespaces(ctx context.Context, containerID string) (*models.ContainerNamespaces, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	containerJSON, err := cachedContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := &models.ContainerNamespaces{}
+	if containerJSON.HostConfig == nil {
+		return namespaces, nil
+	}
+
+	hostConfig := containerJSON.HostConfig
+	namespaces.Network = namespaceMode(ctx, string(hostConfig.NetworkMode))
+	namespaces.PID = namespaceMode(ctx, string(hostConfig.PidMode))
+	namespaces.IPC = namespaceMode(ctx, string(hostConfig.IpcMode))
+	namespaces.UTS = namespaceMode(ctx, string(hostConfig.UTSMode))
+	namespaces.Userns = namespaceMode(ctx, string(hostConfig.UsernsMode))
+
+	return namespaces, nil
 }
 
-func StopContainer(containerID string) error {
-	ctx := context.Background()
-	timeout := 10
-	return DockerClient.ContainerStop(ctx, containerID, container.StopOptions{Timeout: &timeout})
+// GetContainerInspectRaw returns the inspect JSON of a container as the
+// daemon sent it. Secret environment variables are masked unless rawEnv is set.
+func GetContainerInspectRaw(ctx context.Context, containerID string, rawEnv bool) ([]byte, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	_, raw, err := DockerClient(ctx).ContainerInspectWithRaw(ctx, containerID, false)
+	if err != nil || rawEnv {
+		return raw, err
+	}
+	return redactRawInspectEnv(raw)
 }
 
-func RestartContainer(containerID string) error {
-	ctx := context.Background()
-	timeout := 10
-	return DockerClient.ContainerRestart(ctx, containerID, container.StopOptions{Timeout: &timeout})
+// GetContainerChanges returns the files a container has added, modified or
+// deleted relative to its image, like `docker diff`
+func GetContainerChanges(ctx context.Context, containerID string) ([]models.ContainerChange, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	diff, err := DockerClient(ctx).ContainerDiff(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]models.ContainerChange, 0, len(diff))
+	for _, change := range diff {
+		changes = append(changes, models.ContainerChange{Path: change.Path, Kind: changeKind(change.Kind)})
+	}
+	return changes, nil
+}
+
+func changeKind(kind container.ChangeType) string {
+	switch kind {
+	case container.ChangeAdd:
+		return "added"
+	case container.ChangeDelete:
+		return "deleted"
+	default:
+		return "modified"
+	}
+}
+
+// namespaceMode describes a namespace mode such as "host" or "container:<id>"
+func namespaceMode(ctx context.Context, mode string) models.NamespaceMode {
+	ns := models.NamespaceMode{Mode: mode, Host: mode == "host"}
+	if ns.Mode == "" {
+		ns.Mode = "default"
+	}
+
+	if ref, ok := strings.CutPrefix(mode, "container:"); ok {
+		ns.Container = ref
+		if other, err := cachedContainerInspect(ctx, ref); err == nil {
+			ns.Container = strings.TrimPrefix(other.Name, "/")
+		}
+	}
+	return ns
+}
+
+func StartContainer(ctx context.Context, containerID string) error {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	defer invalidateContainerCaches()
+	return DockerClient(ctx).ContainerStart(ctx, containerID, types.ContainerStartOptions{})
+}
+
+// defaultStopSignal is sent by the daemon when the image declares no STOPSIGNAL
+const defaultStopSignal = "SIGTERM"
+
+// StopContainer stops a container, waiting timeout seconds before killing it
+// or StopTimeout when timeout is nil. No signal is given so the daemon sends
+// the container's configured stop signal, falling back to SIGTERM.
+func StopContainer(ctx context.Context, containerID string, timeout *int) error {
+	if timeout == nil {
+		timeout = &StopTimeout
+	}
+	ctx, cancel := withStopTimeout(ctx, *timeout)
+	defer cancel()
+	defer invalidateContainerCaches()
+	return DockerClient(ctx).ContainerStop(ctx, containerID, container.StopOptions{Timeout: timeout})
 }
 
-func StreamSystemEvents(ctx context.Context, since, until string, w http.ResponseWriter) error {
-	options := types.EventsOptions{}
+// RestartContainer restarts a container using the same timeout rules as StopContainer
+func RestartContainer(ctx context.Context, containerID string, timeout *int) error {
+	if timeout == nil {
+		timeout = &StopTimeout
+	}
+	ctx, cancel := withStopTimeout(ctx, *timeout)
+	defer cancel()
+	defer invalidateContainerCaches()
+	return DockerClient(ctx).ContainerRestart(ctx, containerID, container.StopOptions{Timeout: timeout})
+}
+
+// ErrContainerNotPaused is returned when unpausing a container that isn't paused
+var ErrContainerNotPaused = errors.New("container is not paused")
+
+// PauseContainer suspends all processes in a container
+func PauseContainer(ctx context.Context, containerID string) error {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	defer invalidateContainerCaches()
+	return DockerClient(ctx).ContainerPause(ctx, containerID)
+}
+
+// UnpauseContainer resumes the processes of a paused container
+func UnpauseContainer(ctx context.Context, containerID string) error {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	containerJSON, err := DockerClient(ctx).ContainerInspect(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	if containerJSON.State == nil || !containerJSON.State.Paused {
+		return ErrContainerNotPaused
+	}
+
+	defer invalidateContainerCaches()
+	return DockerClient(ctx).ContainerUnpause(ctx, containerID)
+}
+
+// ErrContainerNotRunning is returned when an operation needs a running container
+var ErrContainerNotRunning = errors.New("container is not running")
+
+// GetContainerTop lists the processes running in a container. psArgs are
+// passed to ps inside the container, the daemon defaults to "-ef".
+func GetContainerTop(ctx context.Context, containerID, psArgs string) (*container.ContainerTopOKBody, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	containerJSON, err := DockerClient(ctx).ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	if containerJSON.State == nil || !containerJSON.State.Running {
+		return nil, ErrContainerNotRunning
+	}
+
+	top, err := DockerClient(ctx).ContainerTop(ctx, containerID, strings.Fields(psArgs))
+	if err != nil {
+		return nil, err
+	}
+	return &top, nil
+}
+
+// ErrContainerRunning is returned when removing a running container without force
+var ErrContainerRunning = errors.New("container is running")
+
+// RemoveContainer removes a container and, when removeVolumes is set, its
+// anonymous volumes. A running container is only removed with force. With
+// dryRun set the container is only checked to exist and be removable.
+func RemoveContainer(ctx context.Context, containerID string, force, removeVolumes, dryRun bool) error {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	if dryRun && force {
+		_, err := DockerClient(ctx).ContainerInspect(ctx, containerID)
+		return err
+	}
+	if !force {
+		containerJSON, err := DockerClient(ctx).ContainerInspect(ctx, containerID)
+		if err != nil {
+			return err
+		}
+		if containerJSON.State != nil && containerJSON.State.Running {
+			return fmt.Errorf("%w: stop it first or remove it with force=true", ErrContainerRunning)
+		}
+		if dryRun {
+			return nil
+		}
+	}
+
+	defer invalidateContainerCaches()
+	return DockerClient(ctx).ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{
+		Force:         force,
+		RemoveVolumes: removeVolumes,
+	})
+}
+
+// ErrInvalidEventFilter is returned when an event filter names an unknown
+// event type
+var ErrInvalidEventFilter = errors.New("invalid event filter")
+
+// eventTypes are the event types Docker reports
+var eventTypes = map[string]bool{
+	events.BuilderEventType:   true,
+	events.ConfigEventType:    true,
+	events.ContainerEventType: true,
+	events.DaemonEventType:    true,
+	events.ImageEventType:     true,
+	events.NetworkEventType:   true,
+	events.NodeEventType:      true,
+	events.PluginEventType:    true,
+	events.SecretEventType:    true,
+	events.ServiceEventType:   true,
+	events.VolumeEventType:    true,
+}
+
+// EventFilter limits an event stream to the given event types, containers
+// (by name or ID) and actions such as die. Values of the same field are
+// alternatives; different fields must all match.
+type EventFilter struct {
+	Types      []string
+	Containers []string
+	Events     []string
+}
+
+// Validate checks that every event type is known
+func (f EventFilter) Validate() error {
+	for _, eventType := range f.Types {
+		if !eventTypes[eventType] {
+			return fmt.Errorf("%w: unknown type %q", ErrInvalidEventFilter, eventType)
+		}
+	}
+	return nil
+}
+
+func (f EventFilter) args() filters.Args {
+	args := filters.NewArgs()
+	for _, eventType := range f.Types {
+		args.Add("type", eventType)
+	}
+	for _, container := range f.Containers {
+		args.Add("container", container)
+	}
+	for _, event := range f.Events {
+		args.Add("event", event)
+	}
+	return args
+}
+
+// WatchSystemEvents calls emit with every Docker event between since and
+// until (unix timestamps, ignored when invalid) that matches filter, until
+// ctx is cancelled, emit fails or the stream ends
+func WatchSystemEvents(ctx context.Context, since, until string, filter EventFilter, emit func(events.Message) error) error {
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+
+	options := types.EventsOptions{Filters: filter.args()}
 	if since != "" {
 		if timestamp, err := strconv.ParseInt(since, 10, 64); err == nil {
 			options.Since = strconv.FormatInt(timestamp, 10)
@@ -184,19 +825,13 @@ func StreamSystemEvents(ctx context.Context, since, until string, w http.Respons
 		}
 	}
 
-	events, errs := DockerClient.Events(ctx, options)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Transfer-Encoding", "chunked")
-
-	encoder := json.NewEncoder(w)
+	messages, errs := DockerClient(ctx).Events(ctx, options)
 
 	for {
 		select {
-		case event := <-events:
-			encoder.Encode(event)
-			if flusher, ok := w.(http.Flusher); ok {
-				flusher.Flush()
+		case event := <-messages:
+			if err := emit(event); err != nil {
+				return err
 			}
 		case err := <-errs:
 			return err
@@ -205,3 +840,21 @@ func StreamSystemEvents(ctx context.Context, since, until string, w http.Respons
 		}
 	}
 }
+
+func StreamSystemEvents(ctx context.Context, since, until string, filter EventFilter, w http.ResponseWriter) error {
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Transfer-Encoding", "chunked")
+
+	encoder := json.NewEncoder(w)
+	return WatchSystemEvents(ctx, since, until, filter, func(event events.Message) error {
+		encoder.Encode(event)
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		return nil
+	})
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+)
+
+// eventSubscriberBuffer is how many events a subscriber can fall behind
+// before it is disconnected
+const eventSubscriberBuffer = 64
+
+// eventHub shares one Docker event subscription between every WebSocket
+// client of a host. The upstream subscription is opened with the first
+// subscriber and closed when the last one leaves.
+type eventHub struct {
+	hostID      string
+	subscribers map[chan events.Message]bool
+	cancel      context.CancelFunc
+}
+
+var (
+	eventHubsMu sync.Mutex
+	eventHubs   = make(map[string]*eventHub)
+)
+
+// SubscribeEvents returns a channel receiving the Docker events of the host
+// selected by ctx and a function that unsubscribes. The channel is closed
+// when the subscriber falls too far behind or is unsubscribed.
+func SubscribeEvents(ctx context.Context) (<-chan events.Message, func()) {
+	hostID := HostID(ctx)
+	ch := make(chan events.Message, eventSubscriberBuffer)
+
+	eventHubsMu.Lock()
+	hub, ok := eventHubs[hostID]
+	if !ok {
+		hub = &eventHub{hostID: hostID, subscribers: make(map[chan events.Message]bool)}
+		eventHubs[hostID] = hub
+	}
+	hub.subscribers[ch] = true
+	if hub.cancel == nil {
+		var upstream context.Context
+		upstream, hub.cancel = context.WithCancel(context.WithValue(context.Background(), hostContextKey{}, hostID))
+		go hub.run(upstream)
+	}
+	eventHubsMu.Unlock()
+
+	return ch, func() { hub.unsubscribe(ch) }
+}
+
+// unsubscribe removes a subscriber, closing the upstream subscription when
+// it was the last one
+func (h *eventHub) unsubscribe(ch chan events.Message) {
+	eventHubsMu.Lock()
+	defer eventHubsMu.Unlock()
+	h.remove(ch)
+}
+
+// remove drops a subscriber with eventHubsMu held
+func (h *eventHub) remove(ch chan events.Message) {
+	if !h.subscribers[ch] {
+		return
+	}
+	delete(h.subscribers, ch)
+	close(ch)
+
+	if len(h.subscribers) == 0 && h.cancel != nil {
+		h.cancel()
+		h.cancel = nil
+		delete(eventHubs, h.hostID)
+	}
+}
+
+// broadcast sends an event to every subscriber. Subscribers whose buffer is
+// full are dropped rather than holding up everyone else.
+func (h *eventHub) broadcast(event events.Message) {
+	eventHubsMu.Lock()
+	defer eventHubsMu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Println("Dropping slow event subscriber")
+			h.remove(ch)
+		}
+	}
+}
+
+// run reads the Docker event stream until ctx is cancelled, resubscribing
+// after errors
+func (h *eventHub) run(ctx context.Context) {
+	for {
+		eventsCh, errs := DockerClient(ctx).Events(ctx, types.EventsOptions{})
+	stream:
+		for {
+			select {
+			case event := <-eventsCh:
+				h.broadcast(event)
+			case err := <-errs:
+				if err != nil && ctx.Err() == nil {
+					log.Println("Docker events error:", err)
+				}
+				break stream
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-time.After(eventRetryDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
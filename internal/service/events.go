@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+)
+
+// eventHistorySize is the number of recent Docker events kept in memory
+const eventHistorySize = 1000
+
+// eventRetryDelay is how long to wait before resubscribing after the Docker
+// event stream fails
+const eventRetryDelay = 5 * time.Second
+
+// eventHistory keeps the most recent Docker events so clients that cannot
+// hold a stream open can catch up by polling
+type eventHistory struct {
+	mu      sync.Mutex
+	events  []events.Message
+	updated chan struct{}
+}
+
+// eventHistories holds the event history of every host by host ID. It is
+// filled by StartEventHistory and not changed afterwards.
+var eventHistories = make(map[string]*eventHistory)
+
+func (h *eventHistory) add(event events.Message) {
+	h.mu.Lock()
+	h.events = append(h.events, event)
+	if len(h.events) > eventHistorySize {
+		h.events = h.events[len(h.events)-eventHistorySize:]
+	}
+	// Wake up everyone waiting for new events
+	close(h.updated)
+	h.updated = make(chan struct{})
+	h.mu.Unlock()
+}
+
+// since returns the events newer than cursor, a channel that is closed when
+// more events arrive, and the cursor to use for the next call
+func (h *eventHistory) since(cursor int64) ([]events.Message, <-chan struct{}, int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	result := []events.Message{}
+	next := cursor
+	for _, event := range h.events {
+		if event.TimeNano > cursor {
+			result = append(result, event)
+			next = event.TimeNano
+		}
+	}
+	return result, h.updated, next
+}
+
+// StartEventHistory subscribes to the Docker event stream of every host in
+// the background and records events until ctx is cancelled
+func StartEventHistory(ctx context.Context) {
+	for hostID := range dockerHosts {
+		history := &eventHistory{updated: make(chan struct{})}
+		eventHistories[hostID] = history
+		hostCtx, _ := WithHost(ctx, hostID)
+		go recordEvents(hostCtx, history)
+	}
+}
+
+// recordEvents records the events of the host selected by ctx, resubscribing
+// after errors, until ctx is cancelled
+func recordEvents(ctx context.Context, history *eventHistory) {
+	for {
+		eventsCh, errs := DockerClient(ctx).Events(ctx, types.EventsOptions{})
+	stream:
+		for {
+			select {
+			case event := <-eventsCh:
+				history.add(event)
+				switch event.Type {
+				case events.ContainerEventType:
+					invalidateContainerCaches()
+					if event.Action == "destroy" {
+						forgetContainerLimits(ctx, event.Actor.ID)
+					}
+				case events.ImageEventType:
+					invalidateImageCaches()
+				}
+			case err := <-errs:
+				if err != nil && ctx.Err() == nil {
+					log.Printf("Event history subscription error on host %s: %v", HostID(ctx), err)
+				}
+				break stream
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-time.After(eventRetryDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// PollEvents returns the recorded events newer than cursor (a timestamp in
+// nanoseconds). When there are none it waits up to wait for new ones, so it
+// returns promptly even if nothing happens. The returned cursor should be
+// passed to the next call.
+func PollEvents(ctx context.Context, cursor int64, wait time.Duration) ([]events.Message, int64) {
+	history, ok := eventHistories[HostID(ctx)]
+	if !ok {
+		return []events.Message{}, cursor
+	}
+
+	result, updated, next := history.since(cursor)
+	if len(result) > 0 {
+		return result, next
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-updated:
+		result, _, next = history.since(cursor)
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return result, next
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"docker-manager/internal/models"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// execResult is the captured output of a command run inside a container
+type execResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// execInContainer runs cmd inside a running container and waits for it to finish
+func execInContainer(ctx context.Context, containerID string, cmd []string) (*execResult, error) {
+	exec, err := DockerClient(ctx).ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	attach, err := DockerClient(ctx).ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return nil, err
+	}
+	defer attach.Close()
+
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, attach.Reader); err != nil {
+		return nil, err
+	}
+
+	inspect, err := DockerClient(ctx).ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &execResult{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		ExitCode: inspect.ExitCode,
+	}, nil
+}
+
+// GetContainerClock compares the clock inside a container with the host
+// clock by running `date +%s` in the container
+func GetContainerClock(ctx context.Context, containerID string) (*models.ContainerClock, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	before := time.Now()
+	result, err := execInContainer(ctx, containerID, []string{"date", "+%s"})
+	after := time.Now()
+
+	// Compare against the midpoint to cancel out the exec round trip
+	hostTime := before.Add(after.Sub(before) / 2).Unix()
+	clock := &models.ContainerClock{HostTime: hostTime}
+
+	if err != nil {
+		if strings.Contains(err.Error(), "executable file not found") || strings.Contains(err.Error(), "no such file") {
+			clock.Error = "container has no date binary"
+			return clock, nil
+		}
+		return nil, err
+	}
+	// 126 and 127 are the shell conventions for a command that can't be run
+	if result.ExitCode == 126 || result.ExitCode == 127 {
+		clock.Error = "container has no date binary"
+		return clock, nil
+	}
+	if result.ExitCode != 0 {
+		clock.Error = fmt.Sprintf("date exited with code %d: %s", result.ExitCode, strings.TrimSpace(result.Stderr))
+		return clock, nil
+	}
+
+	containerTime, err := strconv.ParseInt(strings.TrimSpace(result.Stdout), 10, 64)
+	if err != nil {
+		clock.Error = fmt.Sprintf("unexpected date output: %q", strings.TrimSpace(result.Stdout))
+		return clock, nil
+	}
+
+	clock.Supported = true
+	clock.ContainerTime = containerTime
+	clock.DriftSeconds = containerTime - hostTime
+	return clock, nil
+}
+
+// defaultShell is run by interactive sessions when no command is given
+const defaultShell = "/bin/sh"
+
+// ExecSession is an interactive command running inside a container with a
+// TTY. Reading returns the terminal output and writing sends input.
+type ExecSession struct {
+	id     string
+	attach types.HijackedResponse
+}
+
+// StartExecSession runs cmd, or a shell when cmd is empty, inside a running
+// container with a TTY attached. The session must be closed by the caller.
+func StartExecSession(ctx context.Context, containerID string, cmd []string) (*ExecSession, error) {
+	if len(cmd) == 0 {
+		cmd = []string{defaultShell}
+	}
+
+	exec, err := DockerClient(ctx).ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		Tty:          true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	attach, err := DockerClient(ctx).ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{Tty: true})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExecSession{id: exec.ID, attach: attach}, nil
+}
+
+func (s *ExecSession) Read(p []byte) (int, error) {
+	return s.attach.Reader.Read(p)
+}
+
+func (s *ExecSession) Write(p []byte) (int, error) {
+	return s.attach.Conn.Write(p)
+}
+
+// Resize sets the size of the session's terminal
+func (s *ExecSession) Resize(ctx context.Context, rows, cols uint) error {
+	return DockerClient(ctx).ContainerExecResize(ctx, s.id, types.ResizeOptions{Height: rows, Width: cols})
+}
+
+// Close detaches from the session. The command keeps running until the
+// terminal hangs up, which closing the connection causes for shells.
+func (s *ExecSession) Close() {
+	s.attach.Close()
+}
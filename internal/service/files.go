@@ -0,0 +1,117 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// ErrNotAFile is returned when downloading a path that isn't a regular file
+var ErrNotAFile = errors.New("not a regular file")
+
+// ContainerFile is a file being read out of a container. It must be closed.
+type ContainerFile struct {
+	io.Reader
+	Name string
+	Size int64
+
+	archive io.Closer
+}
+
+func (f *ContainerFile) Close() error {
+	return f.archive.Close()
+}
+
+// OpenContainerFile opens a regular file inside a container, following a
+// symlink at filePath. The archive API also works on stopped containers.
+func OpenContainerFile(ctx context.Context, containerID, filePath string) (*ContainerFile, error) {
+	reader, stat, err := DockerClient(ctx).CopyFromContainer(ctx, containerID, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if stat.Mode&os.ModeSymlink != 0 && stat.LinkTarget != "" {
+		reader.Close()
+		reader, stat, err = DockerClient(ctx).CopyFromContainer(ctx, containerID, stat.LinkTarget)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !stat.Mode.IsRegular() {
+		reader.Close()
+		return nil, fmt.Errorf("%w: %s", ErrNotAFile, filePath)
+	}
+
+	// The archive holds just the file
+	archive := tar.NewReader(reader)
+	header, err := archive.Next()
+	if err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("failed to read archive of %s: %w", filePath, err)
+	}
+
+	return &ContainerFile{
+		Reader:  archive,
+		Name:    path.Base(header.Name),
+		Size:    header.Size,
+		archive: reader,
+	}, nil
+}
+
+// ErrInvalidFileName is returned when an uploaded file name isn't a plain
+// file name
+var ErrInvalidFileName = errors.New("invalid file name")
+
+// FileUpload is a file to copy into a container. The file is owned by UID
+// and GID unless CopyUIDGID is set, in which case it gets the container
+// user's ownership.
+type FileUpload struct {
+	Name       string
+	Content    []byte
+	UID        int
+	GID        int
+	CopyUIDGID bool
+}
+
+// UploadContainerFile writes a file into the directory dir of a container,
+// replacing any file of the same name
+func UploadContainerFile(ctx context.Context, containerID, dir string, file FileUpload) error {
+	if file.Name == "" || file.Name == "." || file.Name == ".." || strings.ContainsAny(file.Name, "/\\") {
+		return fmt.Errorf("%w: %q", ErrInvalidFileName, file.Name)
+	}
+
+	// The archive API only accepts tar archives
+	var buf bytes.Buffer
+	archive := tar.NewWriter(&buf)
+	header := &tar.Header{
+		Name:    file.Name,
+		Mode:    0644,
+		Size:    int64(len(file.Content)),
+		Uid:     file.UID,
+		Gid:     file.GID,
+		ModTime: time.Now(),
+	}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := archive.Write(file.Content); err != nil {
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	return DockerClient(ctx).CopyToContainer(ctx, containerID, dir, &buf, types.CopyToContainerOptions{
+		CopyUIDGID: file.CopyUIDGID,
+	})
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"sort"
+	"time"
+
+	"docker-manager/internal/config"
+	"docker-manager/internal/models"
+	"docker-manager/internal/version"
+
+	"github.com/docker/docker/client"
+)
+
+// dockerHost is a Docker daemon the manager is connected to
+type dockerHost struct {
+	id      string
+	address string
+	client  *client.Client
+}
+
+var (
+	// dockerHosts holds every configured daemon by ID. It is only written
+	// by InitDockerClient, before the server starts.
+	dockerHosts   = map[string]*dockerHost{}
+	primaryHostID string
+)
+
+// ErrUnknownHost is returned when a request selects a host that isn't configured
+var ErrUnknownHost = errors.New("unknown docker host")
+
+// ErrPrimaryHostOnly is returned by features that only work for the primary
+// host, the daemon on the machine running the manager
+var ErrPrimaryHostOnly = errors.New("only available for the primary host")
+
+type hostContextKey struct{}
+
+// InitDockerClient connects to the primary daemon and every additional host
+// in cfg. Each host is pinged once to warn about daemons that are down, but
+// unreachable hosts only fail the requests that select them.
+func InitDockerClient(cfg *config.Config) {
+	primary, err := newDockerClient(cfg.DockerHost, cfg.TLS, client.FromEnv)
+	if err != nil {
+		log.Fatal("Failed to create Docker client:", err)
+	}
+	primaryHostID = cfg.HostID
+	dockerHosts[cfg.HostID] = &dockerHost{id: cfg.HostID, address: primary.DaemonHost(), client: primary}
+
+	for _, host := range cfg.Hosts {
+		c, err := newDockerClient(host.DockerHost, host.TLS)
+		if err != nil {
+			log.Fatalf("Failed to create Docker client for host %s: %v", host.ID, err)
+		}
+		dockerHosts[host.ID] = &dockerHost{id: host.ID, address: c.DaemonHost(), client: c}
+	}
+
+	for _, host := range dockerHosts {
+		ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+		if _, err := host.client.Ping(ctx); err != nil {
+			log.Printf("Warning: Docker daemon of host %s at %s is unavailable, requests to it will fail until it is reachable: %v", host.id, host.address, err)
+		}
+		cancel()
+	}
+}
+
+// newDockerClient connects to host, or to the daemon configured through opts
+// when host is empty, using the given certificates when set
+func newDockerClient(host string, tls config.TLS, opts ...client.Opt) (*client.Client, error) {
+	opts = append(opts, client.WithAPIVersionNegotiation())
+	if host != "" {
+		opts = append(opts, client.WithHost(host))
+	}
+	if tls.Enabled() {
+		opts = append(opts, client.WithTLSClientConfig(tls.CACert, tls.Cert, tls.Key))
+	}
+	return client.NewClientWithOpts(opts...)
+}
+
+// CloseDockerClients closes the connections to every host
+func CloseDockerClients() {
+	for _, host := range dockerHosts {
+		host.client.Close()
+	}
+}
+
+// WithHost returns a context selecting the host with the given ID for every
+// Docker call made with it. An empty ID selects the primary host.
+func WithHost(ctx context.Context, hostID string) (context.Context, error) {
+	if hostID == "" {
+		return ctx, nil
+	}
+	if _, ok := dockerHosts[hostID]; !ok {
+		return ctx, fmt.Errorf("%w: %s", ErrUnknownHost, hostID)
+	}
+	return context.WithValue(ctx, hostContextKey{}, hostID), nil
+}
+
+// pingTimeout bounds the daemon ping used for readiness checks
+const pingTimeout = 2 * time.Second
+
+// PingDocker checks that the primary daemon answers within pingTimeout
+func PingDocker(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	_, err := dockerHosts[primaryHostID].client.Ping(ctx)
+	return err
+}
+
+// GetVersionInfo returns the build information of docker-manager and the API
+// version negotiated with the host selected by ctx
+func GetVersionInfo(ctx context.Context) *models.VersionInfo {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	// Negotiation happens on the first request, so make sure it has happened
+	DockerClient(ctx).NegotiateAPIVersion(ctx)
+
+	return &models.VersionInfo{
+		Version:          version.Version,
+		Commit:           version.Commit,
+		BuildDate:        version.BuildDate,
+		GoVersion:        runtime.Version(),
+		DockerAPIVersion: DockerClient(ctx).ClientVersion(),
+	}
+}
+
+// HostID returns the ID of the host selected by ctx
+func HostID(ctx context.Context) string {
+	if hostID, ok := ctx.Value(hostContextKey{}).(string); ok {
+		return hostID
+	}
+	return primaryHostID
+}
+
+// DockerClient returns the client of the host selected by ctx
+func DockerClient(ctx context.Context) *client.Client {
+	return dockerHosts[HostID(ctx)].client
+}
+
+// hostScoped prefixes a cache key with the host selected by ctx, since names
+// and short IDs aren't unique across hosts
+func hostScoped(ctx context.Context, key string) string {
+	return HostID(ctx) + "/" + key
+}
+
+// ListHosts returns the configured hosts, primary first
+func ListHosts() []models.DockerHost {
+	hosts := make([]models.DockerHost, 0, len(dockerHosts))
+	for _, host := range dockerHosts {
+		hosts = append(hosts, models.DockerHost{
+			ID:      host.id,
+			Address: host.address,
+			Primary: host.id == primaryHostID,
+		})
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		if hosts[i].Primary != hosts[j].Primary {
+			return hosts[i].Primary
+		}
+		return hosts[i].ID < hosts[j].ID
+	})
+	return hosts
+}
@@ -0,0 +1,337 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"docker-manager/internal/models"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// SearchImages searches the registry for images matching term. registryAuth
+// is the base64-encoded auth config for private registries and may be empty.
+func SearchImages(ctx context.Context, term string, limit int, registryAuth string) ([]registry.SearchResult, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	return DockerClient(ctx).ImageSearch(ctx, term, types.ImageSearchOptions{
+		RegistryAuth: registryAuth,
+		Limit:        limit,
+	})
+}
+
+// GetImageDetails lists images along with the creation time of the most
+// recent local container created from each one
+func GetImageDetails(ctx context.Context) ([]models.ImageDetail, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+
+	images, err := cachedImageList(ctx, types.ImageListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := cachedContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+
+	lastUsed := make(map[string]int64)
+	for _, c := range containers {
+		if c.Created > lastUsed[c.ImageID] {
+			lastUsed[c.ImageID] = c.Created
+		}
+	}
+
+	details := make([]models.ImageDetail, 0, len(images))
+	for _, img := range images {
+		detail := models.ImageDetail{ImageSummary: img}
+		if created, ok := lastUsed[img.ID]; ok {
+			t := time.Unix(created, 0).UTC()
+			detail.LastUsed = &t
+		}
+		details = append(details, detail)
+	}
+
+	return details, nil
+}
+
+// ListImages lists all images, including intermediate layers
+func ListImages(ctx context.Context) ([]types.ImageSummary, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	return cachedImageList(ctx, types.ImageListOptions{All: true})
+}
+
+// platformPattern matches platforms such as linux/amd64 or linux/arm/v7
+var platformPattern = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`)
+
+// ErrInvalidPlatform is returned for a platform that isn't os/arch[/variant]
+var ErrInvalidPlatform = errors.New("platform must be os/arch[/variant], such as linux/arm64")
+
+// ValidatePlatform checks that platform is empty or of the form os/arch[/variant]
+func ValidatePlatform(platform string) error {
+	if platform != "" && !platformPattern.MatchString(platform) {
+		return fmt.Errorf("%w: %q", ErrInvalidPlatform, platform)
+	}
+	return nil
+}
+
+// PullImage pulls an image, which may be pinned to a digest
+// (name@sha256:...), passing each progress message from the daemon to
+// progress. For multi-arch images platform selects the variant to pull, the
+// daemon's own platform when empty. Pull failures are reported inside the
+// progress stream, so the first error message is returned as the pull's error.
+func PullImage(ctx context.Context, ref, platform string, progress func(*jsonmessage.JSONMessage)) error {
+	if err := ValidatePlatform(platform); err != nil {
+		return err
+	}
+
+	reader, err := DockerClient(ctx).ImagePull(ctx, ref, types.ImagePullOptions{
+		Platform:     platform,
+		RegistryAuth: registryAuthFor(ref),
+	})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	decoder := json.NewDecoder(reader)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if msg.Error != nil {
+			return errors.New(msg.Error.Message)
+		}
+		if msg.ErrorMessage != "" {
+			return errors.New(msg.ErrorMessage)
+		}
+		if progress != nil {
+			progress(&msg)
+		}
+	}
+}
+
+// BuildError is a failed build step reported by the daemon
+type BuildError struct {
+	Step    string
+	Message string
+}
+
+func (e *BuildError) Error() string {
+	if e.Step == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Step, e.Message)
+}
+
+// BuildImage builds an image from a tar build context, passing each message
+// from the daemon to progress, and returns the ID of the built image. Like
+// pulls, build failures are reported inside the stream; they are returned as
+// a *BuildError naming the step that failed.
+func BuildImage(ctx context.Context, buildContext io.Reader, tags []string, dockerfile string, progress func(*jsonmessage.JSONMessage)) (string, error) {
+	response, err := DockerClient(ctx).ImageBuild(ctx, buildContext, types.ImageBuildOptions{
+		Tags:       tags,
+		Dockerfile: dockerfile,
+		Remove:     true,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	defer invalidateImageCaches()
+
+	var step, imageID string
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return imageID, nil
+			}
+			return "", err
+		}
+		if strings.HasPrefix(msg.Stream, "Step ") {
+			step = strings.TrimSpace(msg.Stream)
+		}
+		if msg.Aux != nil {
+			var aux types.BuildResult
+			if json.Unmarshal(*msg.Aux, &aux) == nil && aux.ID != "" {
+				imageID = aux.ID
+			}
+		}
+		if progress != nil {
+			progress(&msg)
+		}
+		if msg.Error != nil {
+			return "", &BuildError{Step: step, Message: msg.Error.Message}
+		}
+		if msg.ErrorMessage != "" {
+			return "", &BuildError{Step: step, Message: msg.ErrorMessage}
+		}
+	}
+}
+
+// PullImages pulls images for platform one after another so they don't
+// compete for bandwidth, reporting progress through emit. A failed pull
+// doesn't stop the remaining ones.
+func PullImages(ctx context.Context, refs []string, platform string, emit func(models.PullEvent)) []models.PullResult {
+	results := make([]models.PullResult, 0, len(refs))
+	for _, ref := range refs {
+		emit(models.PullEvent{Image: ref, Status: "pulling"})
+
+		err := PullImage(ctx, ref, platform, func(msg *jsonmessage.JSONMessage) {
+			emit(models.PullEvent{Image: ref, Status: "progress", Progress: msg})
+		})
+
+		result := models.PullResult{Image: ref, Status: "done"}
+		if err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+		}
+		emit(models.PullEvent{Image: ref, Status: result.Status, Error: result.Error})
+		results = append(results, result)
+	}
+
+	invalidateImageCaches()
+	return results
+}
+
+// ErrImageInUse is returned when removing an image a container still uses
+var ErrImageInUse = errors.New("image is in use")
+
+// RemoveImage removes an image and returns the images untagged and layers
+// deleted. Without force an image used by a container is not removed. With
+// dryRun set nothing is removed and the expected result is returned.
+func RemoveImage(ctx context.Context, imageID string, force, pruneChildren, dryRun bool) ([]types.ImageDeleteResponseItem, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	if dryRun {
+		return previewImageRemoval(ctx, imageID, force)
+	}
+	deleted, err := DockerClient(ctx).ImageRemove(ctx, imageID, types.ImageRemoveOptions{
+		Force:         force,
+		PruneChildren: pruneChildren,
+	})
+	if err != nil {
+		if errdefs.IsConflict(err) {
+			return nil, fmt.Errorf("%w: %v", ErrImageInUse, err)
+		}
+		return nil, err
+	}
+	invalidateImageCaches()
+
+	return deleted, nil
+}
+
+// previewImageRemoval lists what RemoveImage would untag and delete. Only the
+// image itself is listed as deleted, not its parent layers.
+func previewImageRemoval(ctx context.Context, imageID string, force bool) ([]types.ImageDeleteResponseItem, error) {
+	image, _, err := DockerClient(ctx).ImageInspectWithRaw(ctx, imageID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Removing one of several tags of an image only untags it
+	if named, err := reference.ParseNormalizedNamed(imageID); err == nil && len(image.RepoTags) > 1 {
+		tag := reference.FamiliarString(reference.TagNameOnly(named))
+		if slices.Contains(image.RepoTags, tag) {
+			return []types.ImageDeleteResponseItem{{Untagged: tag}}, nil
+		}
+	}
+
+	if !force {
+		containers, err := DockerClient(ctx).ContainerList(ctx, types.ContainerListOptions{
+			All:     true,
+			Filters: filters.NewArgs(filters.Arg("ancestor", image.ID)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(containers) > 0 {
+			return nil, fmt.Errorf("%w: used by container %s", ErrImageInUse, containerName(containers[0]))
+		}
+	}
+
+	items := make([]types.ImageDeleteResponseItem, 0, len(image.RepoTags)+len(image.RepoDigests)+1)
+	for _, tag := range image.RepoTags {
+		items = append(items, types.ImageDeleteResponseItem{Untagged: tag})
+	}
+	for _, digest := range image.RepoDigests {
+		items = append(items, types.ImageDeleteResponseItem{Untagged: digest})
+	}
+	return append(items, types.ImageDeleteResponseItem{Deleted: image.ID}), nil
+}
+
+// GetImageDigests returns the local digests of an image and looks up its
+// manifest digest and platforms in the registry it was pulled from, using
+// the stored credentials for that registry when registryAuth is empty.
+// Registry failures are reported in the result rather than as an error,
+// since images built locally have no registry to ask.
+func GetImageDigests(ctx context.Context, imageID string, registryAuth string) (*models.ImageDigests, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+
+	image, _, err := DockerClient(ctx).ImageInspectWithRaw(ctx, imageID)
+	if err != nil {
+		return nil, err
+	}
+
+	digests := &models.ImageDigests{
+		ID:           image.ID,
+		ConfigDigest: image.ID,
+		RepoDigests:  image.RepoDigests,
+	}
+	if digests.RepoDigests == nil {
+		digests.RepoDigests = []string{}
+	}
+
+	// Prefer the tag the user knows the image by, else the pinned digest
+	switch {
+	case len(image.RepoTags) > 0:
+		digests.Reference = image.RepoTags[0]
+	case len(image.RepoDigests) > 0:
+		digests.Reference = image.RepoDigests[0]
+	default:
+		digests.DistributionError = "image has no repository reference"
+		return digests, nil
+	}
+
+	if registryAuth == "" {
+		registryAuth = registryAuthFor(digests.Reference)
+	}
+	distribution, err := DockerClient(ctx).DistributionInspect(ctx, digests.Reference, registryAuth)
+	if err != nil {
+		digests.DistributionError = err.Error()
+		return digests, nil
+	}
+
+	digests.ManifestDigest = distribution.Descriptor.Digest.String()
+	digests.MediaType = distribution.Descriptor.MediaType
+	for _, platform := range distribution.Platforms {
+		name := platform.OS + "/" + platform.Architecture
+		if platform.Variant != "" {
+			name += "/" + platform.Variant
+		}
+		digests.Platforms = append(digests.Platforms, name)
+	}
+
+	return digests, nil
+}
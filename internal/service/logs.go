@@ -0,0 +1,287 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"docker-manager/internal/models"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// errBundleFull signals that the logs bundle reached its size limit
+var errBundleFull = errors.New("logs bundle size limit reached")
+
+// limitedWriter writes until its shared byte budget is exhausted
+type limitedWriter struct {
+	w         io.Writer
+	remaining *int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if *l.remaining <= 0 {
+		return 0, errBundleFull
+	}
+	if int64(len(p)) > *l.remaining {
+		n, err := l.w.Write(p[:*l.remaining])
+		*l.remaining -= int64(n)
+		if err == nil {
+			err = errBundleFull
+		}
+		return n, err
+	}
+	n, err := l.w.Write(p)
+	*l.remaining -= int64(n)
+	return n, err
+}
+
+// containerName returns the primary name of a container without the leading slash
+func containerName(c types.Container) string {
+	if len(c.Names) > 0 {
+		return strings.TrimPrefix(c.Names[0], "/")
+	}
+	if len(c.ID) > 12 {
+		return c.ID[:12]
+	}
+	return c.ID
+}
+
+// WriteLogsBundle writes a zip archive to w containing the last tail lines
+// of logs for every running container, one <name>.log file per container.
+// Writing stops once maxBytes of log data have been archived.
+func WriteLogsBundle(ctx context.Context, w io.Writer, tail string, maxBytes int64) error {
+	containers, err := DockerClient(ctx).ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(filters.Arg("status", "running")),
+	})
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+	remaining := maxBytes
+
+	for _, c := range containers {
+		if remaining <= 0 {
+			break
+		}
+
+		entry, err := archive.Create(containerName(c) + ".log")
+		if err != nil {
+			return err
+		}
+		out := &limitedWriter{w: entry, remaining: &remaining}
+
+		if err := copyContainerLogs(ctx, c.ID, tail, out); err != nil && !errors.Is(err, errBundleFull) {
+			io.WriteString(entry, "\nfailed to read logs: "+err.Error()+"\n")
+		}
+	}
+
+	return archive.Close()
+}
+
+// ContainerLogs is an open log stream of a container
+type ContainerLogs struct {
+	io.ReadCloser
+	tty bool
+}
+
+// OpenContainerLogs opens the logs of a container. The container is
+// inspected first because TTY output is a raw stream while everything else
+// is multiplexed.
+func OpenContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (*ContainerLogs, error) {
+	containerJSON, err := DockerClient(ctx).ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	logs, err := DockerClient(ctx).ContainerLogs(ctx, containerID, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContainerLogs{
+		ReadCloser: logs,
+		tty:        containerJSON.Config != nil && containerJSON.Config.Tty,
+	}, nil
+}
+
+// Copy writes the demultiplexed logs to out
+func (l *ContainerLogs) Copy(out io.Writer) error {
+	if l.tty {
+		_, err := io.Copy(out, l)
+		return err
+	}
+	_, err := stdcopy.StdCopy(out, out, l)
+	return err
+}
+
+// EmitLines calls emit with every line of the logs, tagged with its stream
+func (l *ContainerLogs) EmitLines(emit func(models.LogLine) error) error {
+	if l.tty {
+		out := &lineWriter{stream: "tty", emit: emit}
+		if _, err := io.Copy(out, l); err != nil {
+			return err
+		}
+		return out.flush()
+	}
+
+	stdout := &lineWriter{stream: "stdout", emit: emit}
+	stderr := &lineWriter{stream: "stderr", emit: emit}
+	if _, err := stdcopy.StdCopy(stdout, stderr, l); err != nil {
+		return err
+	}
+	if err := stdout.flush(); err != nil {
+		return err
+	}
+	return stderr.flush()
+}
+
+// copyContainerLogs writes the demultiplexed logs of a container to out
+func copyContainerLogs(ctx context.Context, containerID, tail string, out io.Writer) error {
+	logs, err := OpenContainerLogs(ctx, containerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       tail,
+		Timestamps: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	return logs.Copy(out)
+}
+
+// GetContainerLogSizes returns the size of the log file of every container
+// using the json-file log driver, largest first. The log files are read from
+// the local filesystem, so this only works when running on the Docker host.
+func GetContainerLogSizes(ctx context.Context) ([]models.ContainerLogSize, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+
+	containers, err := cachedContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := []models.ContainerLogSize{}
+	for _, c := range containers {
+		containerJSON, err := cachedContainerInspect(ctx, c.ID)
+		if err != nil {
+			continue
+		}
+		if containerJSON.HostConfig == nil || containerJSON.HostConfig.LogConfig.Type != "json-file" {
+			continue
+		}
+
+		size := models.ContainerLogSize{
+			ID:      c.ID,
+			Name:    containerName(c),
+			LogPath: containerJSON.LogPath,
+		}
+		if info, err := os.Stat(containerJSON.LogPath); err == nil {
+			size.Size = info.Size()
+		} else {
+			size.Error = err.Error()
+		}
+		sizes = append(sizes, size)
+	}
+
+	sort.Slice(sizes, func(i, j int) bool {
+		return sizes[i].Size > sizes[j].Size
+	})
+
+	return sizes, nil
+}
+
+// lineWriter splits written data into lines and passes each one to emit
+type lineWriter struct {
+	stream string
+	emit   func(models.LogLine) error
+	buf    []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := strings.TrimSuffix(string(l.buf[:i]), "\r")
+		l.buf = l.buf[i+1:]
+		if err := l.emit(models.LogLine{Stream: l.stream, Line: line}); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// flush emits any final line that wasn't terminated by a newline
+func (l *lineWriter) flush() error {
+	if len(l.buf) == 0 {
+		return nil
+	}
+	line := string(l.buf)
+	l.buf = nil
+	return l.emit(models.LogLine{Stream: l.stream, Line: line})
+}
+
+// FollowContainerLogs calls emit with the last tail lines of a container's
+// output and then with every new line until ctx is cancelled, emit fails or
+// the container stops
+func FollowContainerLogs(ctx context.Context, containerID, tail string, emit func(models.LogLine) error) error {
+	logs, err := OpenContainerLogs(ctx, containerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Tail:       tail,
+		Timestamps: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	return logs.EmitLines(emit)
+}
+
+// ErrInvalidLogPattern is returned when a log search regex doesn't compile
+var ErrInvalidLogPattern = errors.New("invalid log search pattern")
+
+// LogLineMatcher returns a filter for timestamped log lines that matches
+// pattern case-insensitively against the message, as a substring or, with
+// regex set, a regular expression. The timestamp is skipped so searching
+// for digits doesn't match every line.
+func LogLineMatcher(pattern string, regex bool) (func(string) bool, error) {
+	message := func(line string) string {
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			return line[i+1:]
+		}
+		return line
+	}
+
+	if regex {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidLogPattern, err)
+		}
+		return func(line string) bool {
+			return re.MatchString(message(line))
+		}, nil
+	}
+
+	pattern = strings.ToLower(pattern)
+	return func(line string) bool {
+		return strings.Contains(strings.ToLower(message(line)), pattern)
+	}, nil
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"docker-manager/internal/models"
+
+	"github.com/docker/docker/api/types"
+)
+
+// defaultNotesFile is where container notes are stored when
+// DOCKER_MANAGER_NOTES_FILE is not set
+const defaultNotesFile = "docker-manager-notes.json"
+
+// notesStore keeps manager-level notes and tags per container ID. They live
+// outside Docker so they can be edited without recreating the container.
+type notesStore struct {
+	mu    sync.Mutex
+	path  string
+	notes map[string]models.ContainerNote
+}
+
+var notes = &notesStore{notes: make(map[string]models.ContainerNote)}
+
+// InitNotes loads the container notes file
+func InitNotes() error {
+	path := os.Getenv("DOCKER_MANAGER_NOTES_FILE")
+	if path == "" {
+		path = defaultNotesFile
+	}
+
+	notes.mu.Lock()
+	defer notes.mu.Unlock()
+	notes.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &notes.notes)
+}
+
+// save writes the notes to disk, replacing the file atomically. The caller
+// must hold the lock.
+func (s *notesStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.notes, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".notes-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func getContainerNote(containerID string) *models.ContainerNote {
+	notes.mu.Lock()
+	defer notes.mu.Unlock()
+
+	if note, ok := notes.notes[containerID]; ok {
+		return &note
+	}
+	return nil
+}
+
+// SetContainerNote stores the notes and tags for a container. An empty note
+// without tags removes the entry.
+func SetContainerNote(ctx context.Context, containerID string, note models.ContainerNote) (*models.ContainerNote, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+
+	// Key by full ID so names and short IDs refer to the same entry
+	containerJSON, err := DockerClient(ctx).ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	notes.mu.Lock()
+	defer notes.mu.Unlock()
+
+	if note.Notes == "" && len(note.Tags) == 0 {
+		delete(notes.notes, containerJSON.ID)
+		return &note, notes.save()
+	}
+
+	if note.Tags == nil {
+		note.Tags = []string{}
+	}
+	note.UpdatedAt = time.Now().UTC()
+	notes.notes[containerJSON.ID] = note
+	return &note, notes.save()
+}
+
+// pruneContainerNotes removes notes for containers that no longer exist on
+// any host. Nothing is removed unless every host could be listed.
+func pruneContainerNotes(ctx context.Context) error {
+	existing := make(map[string]bool)
+	for _, host := range ListHosts() {
+		hostCtx, _ := WithHost(ctx, host.ID)
+		containers, err := DockerClient(hostCtx).ContainerList(hostCtx, types.ContainerListOptions{All: true})
+		if err != nil {
+			return fmt.Errorf("host %s: %w", host.ID, err)
+		}
+		for _, c := range containers {
+			existing[c.ID] = true
+		}
+	}
+
+	notes.mu.Lock()
+	defer notes.mu.Unlock()
+
+	removed := 0
+	for id := range notes.notes {
+		if !existing[id] {
+			delete(notes.notes, id)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return nil
+	}
+	return notes.save()
+}
+
+// StartNotesCleanup periodically removes notes of deleted containers until
+// ctx is cancelled
+func StartNotesCleanup(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := pruneContainerNotes(ctx); err != nil {
+					log.Println("Container notes cleanup error:", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+var Upgrader = websocket.Upgrader{
+	CheckOrigin: checkOrigin,
+}
+
+var (
+	// allowedOrigins are origins besides the server's own that may open
+	// WebSockets, normalized by normalizeOrigin
+	allowedOrigins = map[string]bool{}
+	// allowAllOrigins disables the origin check entirely
+	allowAllOrigins bool
+
+	// corsOrigins are the origins whose pages may call the API, normalized
+	// by normalizeOrigin
+	corsOrigins = map[string]bool{}
+	// corsAllOrigins lets pages of any origin call the API
+	corsAllOrigins bool
+)
+
+// InitAllowedOrigins sets the extra origins allowed to open WebSockets, or
+// disables the origin check entirely when allowAll is set
+func InitAllowedOrigins(origins []string, allowAll bool) error {
+	allowAllOrigins = allowAll
+	for _, origin := range origins {
+		normalized, ok := normalizeOrigin(origin)
+		if !ok {
+			return fmt.Errorf("allowed origins must look like https://host[:port], got %q", origin)
+		}
+		allowedOrigins[normalized] = true
+	}
+	return nil
+}
+
+// InitCORSOrigins sets the origins whose pages may call the API, where "*"
+// stands for any origin
+func InitCORSOrigins(origins []string) error {
+	for _, origin := range origins {
+		if origin == "*" {
+			corsAllOrigins = true
+			continue
+		}
+		normalized, ok := normalizeOrigin(origin)
+		if !ok {
+			return fmt.Errorf("CORS origins must look like https://host[:port] or be *, got %q", origin)
+		}
+		corsOrigins[normalized] = true
+	}
+	return nil
+}
+
+// CORSOriginAllowed reports whether pages of origin may call the API
+func CORSOriginAllowed(origin string) bool {
+	if corsAllOrigins {
+		return true
+	}
+	normalized, ok := normalizeOrigin(origin)
+	return ok && corsOrigins[normalized]
+}
+
+// checkOrigin allows WebSocket handshakes from the server's own origin, from
+// clients that don't send an Origin header (they aren't browsers, so can't be
+// abused by another website) and from the configured origins
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || allowAllOrigins {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	normalized, ok := normalizeOrigin(origin)
+	return ok && allowedOrigins[normalized]
+}
+
+// normalizeOrigin lowercases an origin and strips any trailing slash
+func normalizeOrigin(origin string) (string, bool) {
+	u, err := url.Parse(strings.TrimSuffix(origin, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return "", false
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), true
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+
+	"docker-manager/internal/config"
+
+	"github.com/docker/docker/api/types"
+)
+
+// redactedValue replaces the value of a secret environment variable
+const redactedValue = "********"
+
+var (
+	redactEnv         bool
+	redactEnvPatterns []string
+)
+
+// InitEnvRedaction sets whether and which environment variables are masked
+// in container details
+func InitEnvRedaction(cfg *config.Config) {
+	redactEnv = cfg.RedactEnv
+	redactEnvPatterns = nil
+	for _, pattern := range cfg.RedactEnvPatterns {
+		redactEnvPatterns = append(redactEnvPatterns, strings.ToUpper(pattern))
+	}
+}
+
+// isSecretEnv reports whether the environment variable name matches one of
+// the redaction patterns
+func isSecretEnv(name string) bool {
+	name = strings.ToUpper(name)
+	for _, pattern := range redactEnvPatterns {
+		if strings.Contains(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactEnvList returns env, as "KEY=value" entries, with the values of
+// secret variables masked. env itself is left alone since it may be shared
+// with the inspect cache.
+func redactEnvList(env []string) []string {
+	redacted := make([]string, len(env))
+	for i, entry := range env {
+		name, _, hasValue := strings.Cut(entry, "=")
+		if hasValue && isSecretEnv(name) {
+			entry = name + "=" + redactedValue
+		}
+		redacted[i] = entry
+	}
+	return redacted
+}
+
+// redactContainerEnv masks secret environment variables in an inspect
+// result, copying its config rather than changing the cached one
+func redactContainerEnv(containerJSON types.ContainerJSON) types.ContainerJSON {
+	if !redactEnv || containerJSON.Config == nil {
+		return containerJSON
+	}
+	containerConfig := *containerJSON.Config
+	containerConfig.Env = redactEnvList(containerConfig.Env)
+	containerJSON.Config = &containerConfig
+	return containerJSON
+}
+
+// redactRawInspectEnv masks secret environment variables in the raw inspect
+// JSON of a container. Everything else is kept as sent, though the keys of
+// the top level and Config objects come out sorted.
+func redactRawInspectEnv(raw []byte) ([]byte, error) {
+	if !redactEnv {
+		return raw, nil
+	}
+
+	var inspect map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &inspect); err != nil {
+		return nil, err
+	}
+	var containerConfig map[string]json.RawMessage
+	if err := json.Unmarshal(inspect["Config"], &containerConfig); err != nil || containerConfig == nil {
+		return raw, nil
+	}
+	var env []string
+	if err := json.Unmarshal(containerConfig["Env"], &env); err != nil || env == nil {
+		return raw, nil
+	}
+
+	var err error
+	if containerConfig["Env"], err = json.Marshal(redactEnvList(env)); err != nil {
+		return nil, err
+	}
+	if inspect["Config"], err = json.Marshal(containerConfig); err != nil {
+		return nil, err
+	}
+	return json.Marshal(inspect)
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"docker-manager/internal/config"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+)
+
+// dockerHubHost is the registry host of images without a registry in their name
+const dockerHubHost = "docker.io"
+
+// registryCredentials are the configured credentials by registry host
+var registryCredentials = make(map[string]registry.AuthConfig)
+
+// InitRegistryAuth loads the registry credentials from cfg
+func InitRegistryAuth(cfg *config.Config) {
+	for _, r := range cfg.Registries {
+		registryCredentials[normalizeRegistryHost(r.Host)] = registry.AuthConfig{
+			Username:      r.Username,
+			Password:      r.Password,
+			RegistryToken: r.Token,
+			ServerAddress: r.Host,
+		}
+	}
+}
+
+// normalizeRegistryHost reduces the ways a registry is written, such as
+// https://index.docker.io/v1/ in ~/.docker/config.json, to its host name
+func normalizeRegistryHost(host string) string {
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	switch host {
+	case "index.docker.io", "registry-1.docker.io":
+		return dockerHubHost
+	}
+	return host
+}
+
+// registryAuthFor returns the encoded credentials for the registry ref is
+// pulled from, or "" when none are known. Configured credentials come first,
+// then those saved by `docker login`.
+func registryAuthFor(ref string) string {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return ""
+	}
+	host := normalizeRegistryHost(reference.Domain(named))
+
+	auth, ok := registryCredentials[host]
+	if !ok {
+		auth, ok = dockerConfigAuth(host)
+	}
+	if !ok {
+		return ""
+	}
+
+	encoded, err := registry.EncodeAuthConfig(auth)
+	if err != nil {
+		return ""
+	}
+	return encoded
+}
+
+// dockerConfigAuth looks up the credentials for host in the Docker CLI
+// config, $DOCKER_CONFIG/config.json or ~/.docker/config.json. The file is
+// read on every lookup so new logins are picked up. Credentials kept by a
+// credential helper aren't supported.
+func dockerConfigAuth(host string) (registry.AuthConfig, bool) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return registry.AuthConfig{}, false
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return registry.AuthConfig{}, false
+	}
+	var cliConfig struct {
+		Auths map[string]struct {
+			Auth          string `json:"auth"`
+			IdentityToken string `json:"identitytoken"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &cliConfig); err != nil {
+		return registry.AuthConfig{}, false
+	}
+
+	for server, entry := range cliConfig.Auths {
+		if normalizeRegistryHost(server) != host {
+			continue
+		}
+		auth := registry.AuthConfig{ServerAddress: server, IdentityToken: entry.IdentityToken}
+		if decoded, err := base64.StdEncoding.DecodeString(entry.Auth); err == nil {
+			auth.Username, auth.Password, _ = strings.Cut(string(decoded), ":")
+		}
+		if auth.Username == "" && auth.IdentityToken == "" {
+			continue
+		}
+		return auth, true
+	}
+	return registry.AuthConfig{}, false
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"docker-manager/internal/models"
+
+	"github.com/docker/docker/api/types/blkiodev"
+	"github.com/docker/docker/api/types/container"
+)
+
+// Docker accepts block I/O weights in this range, 0 leaves the weight unset
+const (
+	minBlkioWeight = 10
+	maxBlkioWeight = 1000
+)
+
+// ErrInvalidBlkioWeight is returned for weights outside Docker's allowed range
+var ErrInvalidBlkioWeight = errors.New("invalid blkio weight")
+
+// GetContainerIOLimits returns the block I/O weight and device limits of a container
+func GetContainerIOLimits(ctx context.Context, containerID string) (*models.ContainerIOLimits, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	containerJSON, err := cachedContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := &models.ContainerIOLimits{
+		WeightDevices:   []models.DeviceWeight{},
+		DeviceReadBps:   []models.DeviceRate{},
+		DeviceWriteBps:  []models.DeviceRate{},
+		DeviceReadIOps:  []models.DeviceRate{},
+		DeviceWriteIOps: []models.DeviceRate{},
+	}
+	if containerJSON.HostConfig == nil {
+		return limits, nil
+	}
+
+	resources := containerJSON.HostConfig.Resources
+	limits.BlkioWeight = resources.BlkioWeight
+	for _, d := range resources.BlkioWeightDevice {
+		limits.WeightDevices = append(limits.WeightDevices, models.DeviceWeight{Path: d.Path, Weight: d.Weight})
+	}
+	limits.DeviceReadBps = toDeviceRates(resources.BlkioDeviceReadBps)
+	limits.DeviceWriteBps = toDeviceRates(resources.BlkioDeviceWriteBps)
+	limits.DeviceReadIOps = toDeviceRates(resources.BlkioDeviceReadIOps)
+	limits.DeviceWriteIOps = toDeviceRates(resources.BlkioDeviceWriteIOps)
+
+	return limits, nil
+}
+
+// ErrDeviceLimitsImmutable is returned when an update changes per-device
+// I/O limits, which the daemon ignores on an existing container
+var ErrDeviceLimitsImmutable = errors.New("device I/O limits can't be changed")
+
+// UpdateContainerIOLimits changes the block I/O weight of a running container
+// and returns the limits now in effect. Docker only applies blkio_weight on
+// an update, so device lists may be sent back as they are but not changed;
+// that takes recreating the container.
+func UpdateContainerIOLimits(ctx context.Context, containerID string, limits models.ContainerIOLimits) (*models.ContainerIOLimits, error) {
+	if err := validateBlkioWeight(limits.BlkioWeight); err != nil {
+		return nil, err
+	}
+
+	current, err := GetContainerIOLimits(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	if (limits.WeightDevices != nil && !slices.Equal(limits.WeightDevices, current.WeightDevices)) ||
+		(limits.DeviceReadBps != nil && !slices.Equal(limits.DeviceReadBps, current.DeviceReadBps)) ||
+		(limits.DeviceWriteBps != nil && !slices.Equal(limits.DeviceWriteBps, current.DeviceWriteBps)) ||
+		(limits.DeviceReadIOps != nil && !slices.Equal(limits.DeviceReadIOps, current.DeviceReadIOps)) ||
+		(limits.DeviceWriteIOps != nil && !slices.Equal(limits.DeviceWriteIOps, current.DeviceWriteIOps)) {
+		return nil, fmt.Errorf("%w: only blkio_weight can be changed on an existing container, device limits need it recreated", ErrDeviceLimitsImmutable)
+	}
+
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	response, err := DockerClient(ctx).ContainerUpdate(ctx, containerID, container.UpdateConfig{
+		Resources: container.Resources{BlkioWeight: limits.BlkioWeight},
+	})
+	if err != nil {
+		return nil, err
+	}
+	invalidateContainerLimits(ctx, containerID)
+	invalidateContainerCaches()
+
+	updated, err := GetContainerIOLimits(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	updated.Warnings = response.Warnings
+	return updated, nil
+}
+
+// UpdateContainer changes the resource limits and restart policy of a
+// container in place, without recreating it
+func UpdateContainer(ctx context.Context, containerID string, req models.ContainerUpdateRequest) (*models.ContainerUpdateResult, error) {
+	if req.Memory < 0 || req.CPUShares < 0 || req.CPUQuota < 0 {
+		return nil, fmt.Errorf("%w: limits can't be negative", ErrInvalidContainerSpec)
+	}
+	if req.MemorySwap < -1 {
+		return nil, fmt.Errorf("%w: memory_swap must be -1 for unlimited or a limit", ErrInvalidContainerSpec)
+	}
+	if req.MemorySwap > 0 && req.Memory > 0 && req.MemorySwap < req.Memory {
+		return nil, fmt.Errorf("%w: memory_swap includes memory so can't be below it", ErrInvalidContainerSpec)
+	}
+	if req.Memory == 0 && req.MemorySwap == 0 && req.CPUShares == 0 && req.CPUQuota == 0 && req.RestartPolicy == "" {
+		return nil, fmt.Errorf("%w: nothing to update", ErrInvalidContainerSpec)
+	}
+
+	restartPolicy, err := parseRestartPolicy(req.RestartPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	response, err := DockerClient(ctx).ContainerUpdate(ctx, containerID, container.UpdateConfig{
+		Resources: container.Resources{
+			Memory:     req.Memory,
+			MemorySwap: req.MemorySwap,
+			CPUShares:  req.CPUShares,
+			CPUQuota:   req.CPUQuota,
+		},
+		RestartPolicy: restartPolicy,
+	})
+	if err != nil {
+		return nil, err
+	}
+	invalidateContainerLimits(ctx, containerID)
+	invalidateContainerCaches()
+
+	result := &models.ContainerUpdateResult{Warnings: response.Warnings}
+	if result.Warnings == nil {
+		result.Warnings = []string{}
+	}
+	return result, nil
+}
+
+func validateBlkioWeight(weight uint16) error {
+	if weight != 0 && (weight < minBlkioWeight || weight > maxBlkioWeight) {
+		return fmt.Errorf("%w: must be between %d and %d, got %d", ErrInvalidBlkioWeight, minBlkioWeight, maxBlkioWeight, weight)
+	}
+	return nil
+}
+
+func toDeviceRates(devices []*blkiodev.ThrottleDevice) []models.DeviceRate {
+	rates := []models.DeviceRate{}
+	for _, d := range devices {
+		rates = append(rates, models.DeviceRate{Path: d.Path, Rate: d.Rate})
+	}
+	return rates
+}
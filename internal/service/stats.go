@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"docker-manager/internal/models"
+
+	"github.com/docker/docker/api/types"
+)
+
+// containerLimits holds the resource limits configured on a container
+type containerLimits struct {
+	Memory    int64
+	CPUQuota  int64
+	CPUPeriod int64
+	NanoCPUs  int64
+}
+
+var (
+	limitsMu sync.Mutex
+	// limitsCache holds container limits by host-scoped full container ID.
+	// Entries are dropped when a container is updated or destroyed.
+	limitsCache = make(map[string]containerLimits)
+	// hostMemory holds the total memory of each Docker host by host ID
+	hostMemory = make(map[string]int64)
+)
+
+// cacheContainerLimits records the limits from an inspect result so that
+// later usage requests don't need to inspect the container again.
+func cacheContainerLimits(ctx context.Context, containerJSON types.ContainerJSON) containerLimits {
+	limits := containerLimits{}
+	if containerJSON.HostConfig != nil {
+		limits.Memory = containerJSON.HostConfig.Memory
+		limits.CPUQuota = containerJSON.HostConfig.CPUQuota
+		limits.CPUPeriod = containerJSON.HostConfig.CPUPeriod
+		limits.NanoCPUs = containerJSON.HostConfig.NanoCPUs
+	}
+
+	if containerJSON.ID != "" {
+		limitsMu.Lock()
+		limitsCache[hostScoped(ctx, containerJSON.ID)] = limits
+		limitsMu.Unlock()
+	}
+	return limits
+}
+
+// invalidateContainerLimits drops the cached limits for a container given by
+// name or ID
+func invalidateContainerLimits(ctx context.Context, containerID string) {
+	if containerJSON, err := cachedContainerInspect(ctx, containerID); err == nil {
+		containerID = containerJSON.ID
+	}
+	forgetContainerLimits(ctx, containerID)
+}
+
+// forgetContainerLimits drops the cached limits for a full container ID
+func forgetContainerLimits(ctx context.Context, containerID string) {
+	limitsMu.Lock()
+	delete(limitsCache, hostScoped(ctx, containerID))
+	limitsMu.Unlock()
+}
+
+// getContainerLimits returns the limits of a container given by its full ID
+func getContainerLimits(ctx context.Context, containerID string) (containerLimits, error) {
+	limitsMu.Lock()
+	limits, ok := limitsCache[hostScoped(ctx, containerID)]
+	limitsMu.Unlock()
+	if ok {
+		return limits, nil
+	}
+
+	containerJSON, err := DockerClient(ctx).ContainerInspect(ctx, containerID)
+	if err != nil {
+		return containerLimits{}, err
+	}
+	return cacheContainerLimits(ctx, containerJSON), nil
+}
+
+// getHostMemory returns the total memory of the Docker host, which is the
+// effective limit for containers without a memory limit.
+func getHostMemory(ctx context.Context) int64 {
+	limitsMu.Lock()
+	total := hostMemory[HostID(ctx)]
+	limitsMu.Unlock()
+	if total > 0 {
+		return total
+	}
+
+	info, err := DockerClient(ctx).Info(ctx)
+	if err != nil {
+		return 0
+	}
+
+	limitsMu.Lock()
+	hostMemory[HostID(ctx)] = info.MemTotal
+	limitsMu.Unlock()
+	return info.MemTotal
+}
+
+// memoryUsage returns the memory used by a container excluding the page
+// cache, matching what `docker stats` reports.
+func memoryUsage(stats *types.StatsJSON) uint64 {
+	usage := stats.MemoryStats.Usage
+	// cgroup v2 reports inactive_file, cgroup v1 reports cache
+	if inactive, ok := stats.MemoryStats.Stats["inactive_file"]; ok && inactive < usage {
+		return usage - inactive
+	}
+	if cache, ok := stats.MemoryStats.Stats["cache"]; ok && cache < usage {
+		return usage - cache
+	}
+	return usage
+}
+
+func computeContainerUsage(ctx context.Context, limits containerLimits, stats *types.StatsJSON) *models.ContainerUsage {
+	usage := &models.ContainerUsage{
+		MemoryUsage:   memoryUsage(stats),
+		MemoryLimit:   limits.Memory,
+		MemoryLimited: limits.Memory > 0,
+		CPUQuota:      limits.CPUQuota,
+		CPUPeriod:     limits.CPUPeriod,
+		NanoCPUs:      limits.NanoCPUs,
+	}
+
+	if !usage.MemoryLimited {
+		usage.MemoryLimit = getHostMemory(ctx)
+	}
+	if usage.MemoryLimit > 0 {
+		usage.MemoryPercent = float64(usage.MemoryUsage) / float64(usage.MemoryLimit) * 100
+	}
+
+	// --cpus is stored as NanoCPUs, --cpu-quota/--cpu-period as a ratio
+	if limits.NanoCPUs > 0 {
+		usage.CPULimit = float64(limits.NanoCPUs) / 1e9
+	} else if limits.CPUQuota > 0 {
+		period := limits.CPUPeriod
+		if period == 0 {
+			period = 100000
+		}
+		usage.CPULimit = float64(limits.CPUQuota) / float64(period)
+	}
+
+	return usage
+}
+
+// GetContainerUsage returns the current resource usage of a container
+// relative to its configured limits
+func GetContainerUsage(ctx context.Context, containerID string) (*models.ContainerUsage, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+
+	// The stats carry the full ID the limits are cached under
+	statsJSON, err := containerStatsOnce(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := getContainerLimits(ctx, statsJSON.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return computeContainerUsage(ctx, limits, statsJSON), nil
+}
+
+// containerStatsOnce returns a single stats sample of a container. The
+// daemon takes two readings, so CPU usage can be computed from it.
+func containerStatsOnce(ctx context.Context, containerID string) (*types.StatsJSON, error) {
+	stats, err := DockerClient(ctx).ContainerStats(ctx, containerID, false)
+	if err != nil {
+		return nil, err
+	}
+	defer stats.Body.Close()
+
+	var statsJSON types.StatsJSON
+	if err := json.NewDecoder(stats.Body).Decode(&statsJSON); err != nil {
+		return nil, err
+	}
+	return &statsJSON, nil
+}
+
+// statsConcurrency bounds how many stats requests are made at once when
+// sampling every container
+const statsConcurrency = 8
+
+// GetAllContainerStats takes one stats sample of every running container,
+// sorted by name. Containers that stop while being sampled are left out.
+func GetAllContainerStats(ctx context.Context) ([]models.ContainerStatsSample, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	containers, err := DockerClient(ctx).ContainerList(ctx, types.ContainerListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]*models.ContainerStatsSample, len(containers))
+	slots := make(chan struct{}, statsConcurrency)
+	var wg sync.WaitGroup
+	for i, c := range containers {
+		wg.Add(1)
+		go func(i int, c types.Container) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			if stats, err := containerStatsOnce(ctx, c.ID); err == nil {
+				sample := statsSample(c.ID, containerName(c), stats)
+				samples[i] = &sample
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	result := make([]models.ContainerStatsSample, 0, len(samples))
+	for _, sample := range samples {
+		if sample != nil {
+			result = append(result, *sample)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
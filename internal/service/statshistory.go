@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"docker-manager/internal/models"
+
+	"github.com/docker/docker/api/types"
+)
+
+// How often container stats are recorded and for how long they are kept
+const (
+	statsHistoryInterval  = 10 * time.Second
+	StatsHistoryRetention = time.Hour
+)
+
+// statsHistorySize is the number of samples kept per container
+const statsHistorySize = int(StatsHistoryRetention / statsHistoryInterval)
+
+// statsSamplerIdle is how long a container keeps being sampled after its
+// history was last requested
+const statsSamplerIdle = 15 * time.Minute
+
+// statsHistoryCleanupInterval is how often idle samplers are stopped and
+// expired histories dropped
+const statsHistoryCleanupInterval = time.Minute
+
+// ErrInsufficientStatsHistory is returned when fewer samples have been
+// recorded than a requested window needs
+var ErrInsufficientStatsHistory = errors.New("insufficient stats history")
+
+// statsSampler holds the recent stats samples of one container. sampling is
+// the context of the goroutine recording them, nil while it isn't running.
+type statsSampler struct {
+	samples  []models.ContainerStatsSample
+	lastUsed time.Time
+	sampling context.Context
+	cancel   context.CancelFunc
+}
+
+func (s *statsSampler) stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.sampling, s.cancel = nil, nil
+}
+
+// statsHistory keeps recent stats samples of the containers whose history
+// has been requested, by host. A container is sampled from the first request
+// for its history until statsSamplerIdle passes without another one or the
+// container stops.
+type statsHistory struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	samplers map[string]*statsSampler
+}
+
+var recordedStats = &statsHistory{samplers: make(map[string]*statsSampler)}
+
+// window returns the samples of a container recorded since the given time
+// and the time of the oldest recorded sample, starting to sample the
+// container if it isn't already
+func (h *statsHistory) window(ctx context.Context, containerID, name string, since time.Time) ([]models.ContainerStatsSample, time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := hostScoped(ctx, containerID)
+	sampler, ok := h.samplers[key]
+	if !ok {
+		sampler = &statsSampler{}
+		h.samplers[key] = sampler
+	}
+	sampler.lastUsed = time.Now()
+	if sampler.sampling == nil && h.ctx != nil {
+		sampler.sampling, sampler.cancel = context.WithCancel(context.WithValue(h.ctx, hostContextKey{}, HostID(ctx)))
+		go h.sample(sampler.sampling, sampler, containerID, name)
+	}
+
+	if len(sampler.samples) == 0 {
+		return nil, time.Time{}
+	}
+	result := []models.ContainerStatsSample{}
+	for _, sample := range sampler.samples {
+		if !sample.Time.Before(since) {
+			result = append(result, sample)
+		}
+	}
+	return result, sampler.samples[0].Time
+}
+
+// sample records the stats of a container every statsHistoryInterval until
+// ctx is cancelled or the container stops
+func (h *statsHistory) sample(ctx context.Context, sampler *statsSampler, containerID, name string) {
+	var last time.Time
+	err := streamContainerStats(ctx, containerID, func(stats *types.StatsJSON) error {
+		// Stopped containers report a single empty sample
+		if stats.Read.IsZero() || stats.Read.Sub(last) < statsHistoryInterval {
+			return nil
+		}
+		last = stats.Read
+
+		h.mu.Lock()
+		samples := append(sampler.samples, statsSample(containerID, name, stats))
+		if len(samples) > statsHistorySize {
+			samples = samples[len(samples)-statsHistorySize:]
+		}
+		sampler.samples = samples
+		h.mu.Unlock()
+		return nil
+	})
+	if err != nil && err != io.EOF && ctx.Err() == nil {
+		log.Println("Stats history error:", err)
+	}
+
+	h.mu.Lock()
+	// A newer sampler may have been started after this one was stopped
+	if sampler.sampling == ctx {
+		sampler.stop()
+	}
+	h.mu.Unlock()
+}
+
+// cleanup stops the samplers nobody asked for within statsSamplerIdle and
+// forgets containers with nothing recorded within the retention period,
+// which includes those that no longer exist
+func (h *statsHistory) cleanup() {
+	now := time.Now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for key, sampler := range h.samplers {
+		if sampler.sampling != nil && now.Sub(sampler.lastUsed) > statsSamplerIdle {
+			sampler.stop()
+		}
+		if sampler.sampling != nil {
+			continue
+		}
+		if len(sampler.samples) == 0 || now.Sub(sampler.samples[len(sampler.samples)-1].Time) > StatsHistoryRetention {
+			delete(h.samplers, key)
+		}
+	}
+}
+
+// StartStatsHistory enables recording container stats on demand until ctx
+// is cancelled, when every sampler stops
+func StartStatsHistory(ctx context.Context) {
+	recordedStats.mu.Lock()
+	recordedStats.ctx = ctx
+	recordedStats.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(statsHistoryCleanupInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				recordedStats.cleanup()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// GetContainerStatsSummary returns the average, minimum, maximum and current
+// CPU and memory usage of a container over the given window. The first
+// request for a container starts recording its stats, so it fails with
+// ErrInsufficientStatsHistory until enough has been recorded.
+func GetContainerStatsSummary(ctx context.Context, containerID string, window time.Duration) (*models.ContainerStatsSummary, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	containerJSON, err := cachedContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	name := strings.TrimPrefix(containerJSON.Name, "/")
+	samples, oldest := recordedStats.window(ctx, containerJSON.ID, name, now.Add(-window))
+	// Allow one interval of slack, samples are never exactly aligned
+	if len(samples) == 0 || oldest.After(now.Add(-window+statsHistoryInterval)) {
+		available := time.Duration(0)
+		if !oldest.IsZero() {
+			available = now.Sub(oldest).Round(time.Second)
+		}
+		return nil, fmt.Errorf("%w: %s requested but only %s recorded", ErrInsufficientStatsHistory, window, available)
+	}
+
+	summary := &models.ContainerStatsSummary{
+		ID:      containerJSON.ID,
+		Name:    name,
+		Window:  window.String(),
+		Samples: len(samples),
+		From:    samples[0].Time,
+		To:      samples[len(samples)-1].Time,
+	}
+	summary.CPUPercent = aggregateStats(samples, func(s models.ContainerStatsSample) float64 { return s.CPUPercent })
+	summary.MemoryUsage = aggregateStats(samples, func(s models.ContainerStatsSample) float64 { return float64(s.MemoryUsage) })
+	summary.MemoryPercent = aggregateStats(samples, func(s models.ContainerStatsSample) float64 { return s.MemoryPercent })
+
+	return summary, nil
+}
+
+// GetContainerStatsHistory returns the stats samples of a container recorded
+// over the given window. Recording starts with the first request for a
+// container, so the history may be shorter than the window.
+func GetContainerStatsHistory(ctx context.Context, containerID string, window time.Duration) (*models.ContainerStatsHistory, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	containerJSON, err := cachedContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimPrefix(containerJSON.Name, "/")
+	samples, _ := recordedStats.window(ctx, containerJSON.ID, name, time.Now().Add(-window))
+	if samples == nil {
+		samples = []models.ContainerStatsSample{}
+	}
+
+	return &models.ContainerStatsHistory{
+		ID:       containerJSON.ID,
+		Name:     name,
+		Window:   window.String(),
+		Interval: statsHistoryInterval.String(),
+		Samples:  samples,
+	}, nil
+}
+
+func aggregateStats(samples []models.ContainerStatsSample, value func(models.ContainerStatsSample) float64) models.StatsAggregate {
+	aggregate := models.StatsAggregate{
+		Current: value(samples[len(samples)-1]),
+		Min:     math.Inf(1),
+		Max:     math.Inf(-1),
+	}
+
+	var total float64
+	for _, sample := range samples {
+		v := value(sample)
+		total += v
+		aggregate.Min = math.Min(aggregate.Min, v)
+		aggregate.Max = math.Max(aggregate.Max, v)
+	}
+	aggregate.Average = total / float64(len(samples))
+
+	return aggregate
+}
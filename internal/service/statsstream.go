@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"docker-manager/internal/models"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// StatsBroadcastInterval is how often the full set of container stats is
+// sent to streaming clients
+const StatsBroadcastInterval = 2 * time.Second
+
+// cpuPercent computes CPU usage the same way `docker stats` does, relative
+// to a single core, so a container using two full cores reports 200%
+func cpuPercent(stats *types.StatsJSON) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	cpus := float64(stats.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	return cpuDelta / systemDelta * cpus * 100
+}
+
+// computeStats derives CPU, memory and network figures from a raw sample
+func computeStats(stats *types.StatsJSON) *models.ComputedStats {
+	computed := &models.ComputedStats{
+		CPUPercent:  cpuPercent(stats),
+		OnlineCPUs:  stats.CPUStats.OnlineCPUs,
+		MemoryUsage: memoryUsage(stats),
+		MemoryLimit: stats.MemoryStats.Limit,
+		Networks:    make(map[string]models.NetworkTotals),
+	}
+	if computed.OnlineCPUs == 0 {
+		computed.OnlineCPUs = uint32(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if computed.MemoryLimit > 0 {
+		computed.MemoryPercent = float64(computed.MemoryUsage) / float64(computed.MemoryLimit) * 100
+	}
+	for name, network := range stats.Networks {
+		computed.Networks[name] = models.NetworkTotals{
+			RxBytes:   network.RxBytes,
+			TxBytes:   network.TxBytes,
+			RxPackets: network.RxPackets,
+			TxPackets: network.TxPackets,
+			RxErrors:  network.RxErrors,
+			TxErrors:  network.TxErrors,
+			RxDropped: network.RxDropped,
+			TxDropped: network.TxDropped,
+		}
+	}
+	return computed
+}
+
+func statsSample(containerID, name string, stats *types.StatsJSON) models.ContainerStatsSample {
+	sample := models.ContainerStatsSample{
+		ID:          containerID,
+		Name:        name,
+		Time:        stats.Read,
+		CPUPercent:  cpuPercent(stats),
+		MemoryUsage: memoryUsage(stats),
+		MemoryLimit: stats.MemoryStats.Limit,
+	}
+	if sample.MemoryLimit > 0 {
+		sample.MemoryPercent = float64(sample.MemoryUsage) / float64(sample.MemoryLimit) * 100
+	}
+	for _, network := range stats.Networks {
+		sample.NetworkRx += network.RxBytes
+		sample.NetworkTx += network.TxBytes
+	}
+	return sample
+}
+
+// streamContainerStats calls update with every stats message from a
+// container until the stream ends, update fails or ctx is cancelled
+func streamContainerStats(ctx context.Context, containerID string, update func(*types.StatsJSON) error) error {
+	stats, err := DockerClient(ctx).ContainerStats(ctx, containerID, true)
+	if err != nil {
+		return err
+	}
+	defer stats.Body.Close()
+
+	decoder := json.NewDecoder(stats.Body)
+	for {
+		var statsJSON types.StatsJSON
+		if err := decoder.Decode(&statsJSON); err != nil {
+			return err
+		}
+		if err := update(&statsJSON); err != nil {
+			return err
+		}
+	}
+}
+
+// StreamContainerStats calls emit with every stats sample of a container,
+// about once a second, until the container stops, emit fails or ctx is
+// cancelled
+func StreamContainerStats(ctx context.Context, containerID string, emit func(models.ContainerStatsSample) error) error {
+	containerJSON, err := cachedContainerInspect(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimPrefix(containerJSON.Name, "/")
+
+	return streamContainerStats(ctx, containerJSON.ID, func(stats *types.StatsJSON) error {
+		return emit(statsSample(containerJSON.ID, name, stats))
+	})
+}
+
+// statsStream is the stats subscription of a single container
+type statsStream struct {
+	id     string
+	cancel context.CancelFunc
+}
+
+// StreamAllContainerStats keeps a stats stream open for every running
+// container, following containers as they start and stop, and calls emit
+// with the latest sample of each one every interval. It returns when ctx is
+// cancelled, emit fails or the event stream fails.
+func StreamAllContainerStats(ctx context.Context, interval time.Duration, emit func([]models.ContainerStatsSample) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	latest := make(map[string]models.ContainerStatsSample)
+	streams := make(map[string]*statsStream)
+	ended := make(chan *statsStream)
+
+	watch := func(containerID, name string) {
+		if _, ok := streams[containerID]; ok {
+			return
+		}
+		streamCtx, stop := context.WithCancel(ctx)
+		stream := &statsStream{id: containerID, cancel: stop}
+		streams[containerID] = stream
+
+		go func() {
+			streamContainerStats(streamCtx, containerID, func(stats *types.StatsJSON) error {
+				mu.Lock()
+				// forget cancels the stream before deleting its sample, so a
+				// sample written after that would never be removed
+				if streamCtx.Err() == nil {
+					latest[containerID] = statsSample(containerID, name, stats)
+				}
+				mu.Unlock()
+				return nil
+			})
+			select {
+			case ended <- stream:
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	forget := func(containerID string) {
+		if stream, ok := streams[containerID]; ok {
+			stream.cancel()
+			delete(streams, containerID)
+		}
+		mu.Lock()
+		delete(latest, containerID)
+		mu.Unlock()
+	}
+
+	// Subscribe before listing so no container start is missed in between
+	eventsCh, errs := DockerClient(ctx).Events(ctx, types.EventsOptions{
+		Filters: filters.NewArgs(filters.Arg("type", "container")),
+	})
+
+	containers, err := DockerClient(ctx).ContainerList(ctx, types.ContainerListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		watch(c.ID, containerName(c))
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event := <-eventsCh:
+			switch event.Action {
+			case "start":
+				watch(event.Actor.ID, event.Actor.Attributes["name"])
+			case "die", "destroy":
+				forget(event.Actor.ID)
+			}
+		case stream := <-ended:
+			// Only forget the container if it hasn't been watched again since
+			if streams[stream.id] == stream {
+				forget(stream.id)
+			}
+		case <-ticker.C:
+			mu.Lock()
+			samples := make([]models.ContainerStatsSample, 0, len(latest))
+			for _, sample := range latest {
+				samples = append(samples, sample)
+			}
+			mu.Unlock()
+
+			sort.Slice(samples, func(i, j int) bool {
+				return samples[i].Name < samples[j].Name
+			})
+			if err := emit(samples); err != nil {
+				return err
+			}
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -2,135 +2,229 @@ package service
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"docker-manager/internal/models"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os/exec"
+	"path"
+	"regexp"
 	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 )
 
-func GetHostSystemInfo() (*models.HostSystemInfo, error) {
-	hostInfo := &models.HostSystemInfo{}
+// GetHostSystemInfo returns uptime, load, memory, swap, disk and network
+// information about the machine the manager runs on. Most of it is only
+// available on Linux; elsewhere Supported is false and those fields are zero.
+func GetHostSystemInfo(ctx context.Context) (*models.HostSystemInfo, error) {
+	hostInfo := &models.HostSystemInfo{
+		Platform:    runtime.GOOS,
+		CPUCores:    runtime.NumCPU(),
+		Filesystems: []models.FilesystemUsage{},
+	}
+	readHostSystemInfo(ctx, hostInfo)
+	return hostInfo, nil
+}
 
-	// Get uptime
-	if uptimeData, err := ioutil.ReadFile("/proc/uptime"); err == nil {
-		uptimeStr := strings.TrimSpace(string(uptimeData))
-		if uptimeParts := strings.Split(uptimeStr, " "); len(uptimeParts) > 0 {
-			if uptimeSeconds, err := strconv.ParseFloat(uptimeParts[0], 64); err == nil {
-				hostInfo.UptimeSeconds = int64(uptimeSeconds)
-				hostInfo.Uptime = formatUptime(int64(uptimeSeconds))
-			}
-		}
+// serviceNamePattern matches valid systemd unit names, including escaped
+// characters and template instances
+var serviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9@._:\\-]+$`)
+
+// ErrInvalidServiceName is returned when a unit name fails validation
+var ErrInvalidServiceName = errors.New("invalid service name")
+
+// ErrInvalidLogLines is returned when the number of journal lines isn't a
+// non-negative integer
+var ErrInvalidLogLines = errors.New("lines must be a non-negative integer")
+
+// ServiceScope selects the systemd manager that commands run against
+type ServiceScope string
+
+const (
+	// SystemScope is the system-wide service manager
+	SystemScope ServiceScope = "system"
+	// UserScope is the service manager of the user running docker-manager
+	UserScope ServiceScope = "user"
+)
+
+// ErrInvalidServiceScope is returned for a scope other than system or user
+var ErrInvalidServiceScope = errors.New("scope must be system or user")
+
+// ParseServiceScope parses a scope, defaulting to the system manager
+func ParseServiceScope(scope string) (ServiceScope, error) {
+	switch ServiceScope(scope) {
+	case "", SystemScope:
+		return SystemScope, nil
+	case UserScope:
+		return UserScope, nil
 	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidServiceScope, scope)
+}
 
-	// Get load average
-	if loadData, err := ioutil.ReadFile("/proc/loadavg"); err == nil {
-		loadStr := strings.TrimSpace(string(loadData))
-		loadParts := strings.Split(loadStr, " ")
-		if len(loadParts) >= 3 {
-			if load1, err := strconv.ParseFloat(loadParts[0], 64); err == nil {
-				hostInfo.LoadAverage1 = load1
-			}
-			if load5, err := strconv.ParseFloat(loadParts[1], 64); err == nil {
-				hostInfo.LoadAverage5 = load5
-			}
-			if load15, err := strconv.ParseFloat(loadParts[2], 64); err == nil {
-				hostInfo.LoadAverage15 = load15
-			}
-		}
+// args prefixes systemctl or journalctl arguments with --user for the user scope
+func (s ServiceScope) args(args ...string) []string {
+	if s == UserScope {
+		return append([]string{"--user"}, args...)
 	}
+	return args
+}
 
-	// Get memory info
-	if memData, err := ioutil.ReadFile("/proc/meminfo"); err == nil {
-		scanner := bufio.NewScanner(strings.NewReader(string(memData)))
-		for scanner.Scan() {
-			line := scanner.Text()
-			if strings.HasPrefix(line, "MemTotal:") {
-				if parts := strings.Fields(line); len(parts) >= 2 {
-					if total, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
-						hostInfo.MemoryTotal = total * 1024 // Convert from KB to bytes
-					}
-				}
-			} else if strings.HasPrefix(line, "MemAvailable:") {
-				if parts := strings.Fields(line); len(parts) >= 2 {
-					if available, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
-						hostInfo.MemoryAvailable = available * 1024 // Convert from KB to bytes
-					}
-				}
-			}
+// ErrInvalidServiceFilter is returned when a service list state or pattern
+// is rejected
+var ErrInvalidServiceFilter = errors.New("invalid service filter")
+
+// serviceStates are the unit states services can be filtered by
+var serviceStates = map[string]bool{"active": true, "inactive": true, "failed": true}
+
+// servicePatternPattern matches unit name globs
+var servicePatternPattern = regexp.MustCompile(`^[A-Za-z0-9@._:\\*?\[\]-]+$`)
+
+// ServiceFilter narrows a service listing to units in a state and/or whose
+// name matches a glob
+type ServiceFilter struct {
+	State   string
+	Pattern string
+}
+
+// args returns the systemctl list-units arguments for the filter
+func (f ServiceFilter) args() ([]string, error) {
+	var args []string
+	if f.State != "" {
+		if !serviceStates[f.State] {
+			return nil, fmt.Errorf("%w: state must be active, inactive or failed", ErrInvalidServiceFilter)
 		}
-		hostInfo.MemoryUsed = hostInfo.MemoryTotal - hostInfo.MemoryAvailable
-		if hostInfo.MemoryTotal > 0 {
-			hostInfo.MemoryUsedPct = float64(hostInfo.MemoryUsed) / float64(hostInfo.MemoryTotal) * 100
+		args = append(args, "--state="+f.State)
+	}
+	if f.Pattern != "" {
+		if strings.HasPrefix(f.Pattern, "-") || !servicePatternPattern.MatchString(f.Pattern) {
+			return nil, fmt.Errorf("%w: pattern %q", ErrInvalidServiceFilter, f.Pattern)
 		}
+		args = append(args, "--", f.Pattern)
+	}
+	return args, nil
+}
+
+// validateServiceName rejects unit names that could be interpreted as
+// options by systemctl or journalctl
+func validateServiceName(name string) error {
+	if name == "" || strings.HasPrefix(name, "-") || !serviceNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidServiceName, name)
 	}
+	return nil
+}
 
-	// Get CPU cores
-	hostInfo.CPUCores = runtime.NumCPU()
+// runCommand runs a command and returns its output. When it fails the error
+// includes what it wrote to stderr, such as "Unit foo.service not found."
+func runCommand(name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = &stderr
 
-	// Get network connections (simplified)
-	if netData, err := ioutil.ReadFile("/proc/net/tcp"); err == nil {
-		lines := strings.Split(string(netData), "\n")
-		hostInfo.NetworkConnections = len(lines) - 2 // Subtract header and last empty line
-		if hostInfo.NetworkConnections < 0 {
-			hostInfo.NetworkConnections = 0
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return output, fmt.Errorf("%s (%w)", message, err)
 		}
+		return output, err
 	}
+	return output, nil
+}
 
-	return hostInfo, nil
+// serviceAllowlist holds the unit names or globs of the services listed by
+// default
+var serviceAllowlist []string
+
+// InitServiceAllowlist sets the unit names or globs of the services listed
+// by default
+func InitServiceAllowlist(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid service allowlist pattern %q: %w", pattern, err)
+		}
+	}
+	serviceAllowlist = patterns
+	return nil
+}
+
+// matchesAllowlist reports whether a service matches any allowlist pattern,
+// either by its short name or its full unit name
+func matchesAllowlist(service models.SystemdService, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, service.Name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, service.Unit); ok {
+			return true
+		}
+	}
+	return false
 }
 
-func formatUptime(seconds int64) string {
-	days := seconds / 86400
-	hours := (seconds % 86400) / 3600
-	minutes := (seconds % 3600) / 60
+// systemdUnit is a unit as printed by `systemctl list-units --output=json`
+type systemdUnit struct {
+	Unit        string `json:"unit"`
+	Load        string `json:"load"`
+	Active      string `json:"active"`
+	Sub         string `json:"sub"`
+	Description string `json:"description"`
+}
 
-	if days > 0 {
-		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
-	} else if hours > 0 {
-		return fmt.Sprintf("%dh %dm", hours, minutes)
-	} else {
-		return fmt.Sprintf("%dm", minutes)
+func (u systemdUnit) service() models.SystemdService {
+	return models.SystemdService{
+		Unit:        u.Unit,
+		Name:        strings.TrimSuffix(u.Unit, ".service"),
+		LoadState:   u.Load,
+		ActiveState: u.Active,
+		SubState:    u.Sub,
+		Description: u.Description,
 	}
 }
 
-func GetSystemdServices() ([]models.SystemdService, error) {
-	cmd := exec.Command("systemctl", "list-units", "--type=service", "--all", "--no-pager", "--no-legend")
-	output, err := cmd.Output()
+// listUnits runs `systemctl list-units` in scope with args and decodes its JSON output
+func listUnits(scope ServiceScope, args ...string) ([]systemdUnit, error) {
+	args = append([]string{"list-units", "--no-pager", "--output=json"}, args...)
+	output, err := runCommand("systemctl", scope.args(args...)...)
 	if err != nil {
 		return nil, err
 	}
 
-	var services []models.SystemdService
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	var units []systemdUnit
+	if err := json.Unmarshal(output, &units); err != nil {
+		return nil, fmt.Errorf("failed to parse systemctl output: %w", err)
+	}
+	return units, nil
+}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
+// GetSystemdServices lists the systemd services on the host. When an
+// allowlist is configured only matching services are returned unless all is set.
+func GetSystemdServices(scope ServiceScope, all bool, filter ServiceFilter) ([]models.SystemdService, error) {
+	filterArgs, err := filter.args()
+	if err != nil {
+		return nil, err
+	}
 
-		// Parse systemctl output
-		fields := strings.Fields(line)
-		if len(fields) >= 4 {
-			service := models.SystemdService{
-				Unit:        fields[0],
-				Name:        strings.TrimSuffix(fields[0], ".service"),
-				LoadState:   fields[1],
-				ActiveState: fields[2],
-				SubState:    fields[3],
-			}
+	units, err := listUnits(scope, append([]string{"--type=service", "--all"}, filterArgs...)...)
+	if err != nil {
+		return nil, err
+	}
 
-			// Get description if available
-			if len(fields) > 4 {
-				service.Description = strings.Join(fields[4:], " ")
-			}
+	var allowlist []string
+	if !all {
+		allowlist = serviceAllowlist
+	}
 
-			services = append(services, service)
+	services := []models.SystemdService{}
+	for _, unit := range units {
+		service := unit.service()
+		if len(allowlist) > 0 && !matchesAllowlist(service, allowlist) {
+			continue
 		}
+		services = append(services, service)
 	}
 
 	// Sort services: running first, then by sub_state alphabetically
@@ -153,14 +247,43 @@ func GetSystemdServices() ([]models.SystemdService, error) {
 	return services, nil
 }
 
-func GetSystemdServiceDetail(serviceName string) (*models.SystemdServiceDetail, error) {
-	// Get service status
-	statusCmd := exec.Command("systemctl", "status", serviceName, "--no-pager", "--lines=0")
-	statusOutput, err := statusCmd.Output()
+// GetFailedServices returns every failed systemd service. The allowlist is
+// ignored so nothing broken is hidden.
+func GetFailedServices(scope ServiceScope) (*models.FailedServices, error) {
+	units, err := listUnits(scope, "--type=service", "--state=failed")
 	if err != nil {
 		return nil, err
 	}
 
+	result := &models.FailedServices{Services: []models.SystemdService{}}
+	for _, unit := range units {
+		result.Services = append(result.Services, unit.service())
+	}
+	sort.Slice(result.Services, func(i, j int) bool {
+		return result.Services[i].Name < result.Services[j].Name
+	})
+	result.Count = len(result.Services)
+
+	return result, nil
+}
+
+// systemctlStatusInactive is the exit code of `systemctl status` for a unit
+// that isn't active
+const systemctlStatusInactive = 3
+
+func GetSystemdServiceDetail(scope ServiceScope, serviceName string) (*models.SystemdServiceDetail, error) {
+	if err := validateServiceName(serviceName); err != nil {
+		return nil, err
+	}
+
+	// Get service status. systemctl status exits with 3 for units that aren't
+	// active, which still prints their full status.
+	statusOutput, err := runCommand("systemctl", scope.args("status", serviceName, "--no-pager", "--lines=0")...)
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == systemctlStatusInactive) {
+		return nil, err
+	}
+
 	// Parse status output
 	service := models.SystemdService{Name: serviceName}
 	statusStr := string(statusOutput)
@@ -194,7 +317,7 @@ func GetSystemdServiceDetail(serviceName string) (*models.SystemdServiceDetail,
 	}
 
 	// Get service properties
-	showCmd := exec.Command("systemctl", "show", serviceName, "--no-pager")
+	showCmd := exec.Command("systemctl", scope.args("show", serviceName, "--no-pager")...)
 	showOutput, err := showCmd.Output()
 	properties := make(map[string]string)
 
@@ -223,7 +346,7 @@ func GetSystemdServiceDetail(serviceName string) (*models.SystemdServiceDetail,
 	}
 
 	// Get recent logs
-	logsCmd := exec.Command("journalctl", "-u", serviceName, "--no-pager", "-n", "50", "--output=short")
+	logsCmd := exec.Command("journalctl", scope.args("-u", serviceName, "--no-pager", "-n", "50", "--output=short")...)
 	logsOutput, _ := logsCmd.Output()
 
 	var logs []string
@@ -245,3 +368,241 @@ func GetSystemdServiceDetail(serviceName string) (*models.SystemdServiceDetail,
 
 	return detail, nil
 }
+
+// GetSystemdServiceDependencies returns the dependency tree of a systemd
+// service along with the units it directly requires and wants
+func GetSystemdServiceDependencies(scope ServiceScope, serviceName string) (*models.SystemdServiceDependencies, error) {
+	if err := validateServiceName(serviceName); err != nil {
+		return nil, err
+	}
+
+	output, err := runCommand("systemctl", scope.args("list-dependencies", serviceName, "--no-pager")...)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := &models.SystemdServiceDependencies{
+		Unit:     serviceName,
+		Requires: []string{},
+		Wants:    []string{},
+		Tree:     parseDependencyTree(string(output)),
+	}
+
+	showCmd := exec.Command("systemctl", scope.args("show", serviceName, "--no-pager", "--property=Id,Requires,Wants")...)
+	if showOutput, err := showCmd.Output(); err == nil {
+		scanner := bufio.NewScanner(strings.NewReader(string(showOutput)))
+		for scanner.Scan() {
+			parts := strings.SplitN(scanner.Text(), "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			switch parts[0] {
+			case "Id":
+				deps.Unit = parts[1]
+			case "Requires":
+				deps.Requires = append(deps.Requires, strings.Fields(parts[1])...)
+			case "Wants":
+				deps.Wants = append(deps.Wants, strings.Fields(parts[1])...)
+			}
+		}
+	}
+
+	return deps, nil
+}
+
+// parseDependencyTree converts the tree drawn by `systemctl list-dependencies`
+// into nested nodes. The first line is the unit itself; every following line
+// is indented two columns per level of depth.
+func parseDependencyTree(output string) []*models.SystemdDependency {
+	var roots []*models.SystemdDependency
+	var stack []*models.SystemdDependency
+
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if i == 0 || strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// Drop the active-state marker that systemctl prints in front of each line
+		runes := []rune(line)
+		if len(runes) > 1 && (runes[0] == '●' || runes[0] == '○' || runes[0] == '*') && runes[1] == ' ' {
+			runes = runes[2:]
+		}
+
+		indent := 0
+		for indent < len(runes) && strings.ContainsRune(" │├└─", runes[indent]) {
+			indent++
+		}
+		if indent == len(runes) {
+			continue
+		}
+
+		depth := indent / 2
+		if depth < 1 {
+			depth = 1
+		}
+		node := &models.SystemdDependency{Unit: strings.TrimSpace(string(runes[indent:]))}
+
+		if depth > len(stack)+1 {
+			depth = len(stack) + 1
+		}
+		stack = stack[:depth-1]
+		if len(stack) == 0 {
+			roots = append(roots, node)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Dependencies = append(parent.Dependencies, node)
+		}
+		stack = append(stack, node)
+	}
+
+	return roots
+}
+
+// ControlSystemdService runs a systemctl action such as start or enable on a service
+func ControlSystemdService(scope ServiceScope, serviceName, action string) error {
+	if err := validateServiceName(serviceName); err != nil {
+		return err
+	}
+	_, err := runCommand("systemctl", scope.args(action, serviceName)...)
+	return err
+}
+
+// validateLogLines checks the number of journal lines requested
+func validateLogLines(lines string) error {
+	if n, err := strconv.Atoi(lines); err != nil || n < 0 {
+		return fmt.Errorf("%w: %q", ErrInvalidLogLines, lines)
+	}
+	return nil
+}
+
+// ErrInvalidLogOutput is returned for a journal output format that isn't allowed
+var ErrInvalidLogOutput = errors.New("output must be short, short-iso, json, cat or verbose")
+
+// journalOutputs are the journalctl output formats that can be requested
+var journalOutputs = map[string]bool{
+	"short":     true,
+	"short-iso": true,
+	"json":      true,
+	"cat":       true,
+	"verbose":   true,
+}
+
+// JournalQuery selects the journal entries of a service: the last Lines
+// entries after Cursor, a cursor returned by a previous query, within the
+// Since and Until times in any format journalctl accepts. Output is the
+// journalctl output format, short by default.
+type JournalQuery struct {
+	Lines  string
+	Cursor string
+	Since  string
+	Until  string
+	Output string
+}
+
+// args returns the journalctl arguments for the query on a service
+func (q JournalQuery) args(serviceName string) ([]string, error) {
+	if err := validateServiceName(serviceName); err != nil {
+		return nil, err
+	}
+	if err := validateLogLines(q.Lines); err != nil {
+		return nil, err
+	}
+	output := q.Output
+	if output == "" {
+		output = "short"
+	}
+	if !journalOutputs[output] {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidLogOutput, output)
+	}
+
+	args := []string{"-u", serviceName, "--no-pager", "-n", q.Lines, "--output=" + output}
+	// The values are attached with = so they can't be taken for options
+	if q.Cursor != "" {
+		args = append(args, "--after-cursor="+q.Cursor)
+	}
+	if q.Since != "" {
+		args = append(args, "--since="+q.Since)
+	}
+	if q.Until != "" {
+		args = append(args, "--until="+q.Until)
+	}
+	return args, nil
+}
+
+// journalCursorPrefix starts the line journalctl --show-cursor ends with
+const journalCursorPrefix = "-- cursor: "
+
+// GetSystemdServiceLogs returns the entries of a service's journal selected
+// by query and the cursor of the last one, to continue from in the next
+// query. Without new entries the query's own cursor is returned.
+func GetSystemdServiceLogs(scope ServiceScope, serviceName string, query JournalQuery) ([]byte, string, error) {
+	args, err := query.args(serviceName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	output, err := runCommand("journalctl", scope.args(append(args, "--show-cursor")...)...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cursor := query.Cursor
+	trimmed := bytes.TrimRight(output, "\n")
+	if i := bytes.LastIndexByte(trimmed, '\n'); bytes.HasPrefix(trimmed[i+1:], []byte(journalCursorPrefix)) {
+		cursor = string(trimmed[i+1+len(journalCursorPrefix):])
+		output = trimmed[:i+1]
+	}
+	return output, cursor, nil
+}
+
+// FollowSystemdServiceLogs writes the entries of a service's journal selected
+// by query to w and then new entries as they arrive, until ctx is cancelled
+func FollowSystemdServiceLogs(ctx context.Context, scope ServiceScope, serviceName string, query JournalQuery, w io.Writer) error {
+	args, err := query.args(serviceName)
+	if err != nil {
+		return err
+	}
+
+	// journalctl -f never exits, so it runs until ctx is cancelled
+	cmd := exec.CommandContext(ctx, "journalctl", scope.args(append(args, "-f")...)...)
+	cmd.Stdout = w
+	return cmd.Run()
+}
+
+// ErrReloadNotSupported is returned when reloading a unit that can't reload
+// its configuration
+var ErrReloadNotSupported = errors.New("service does not support reload")
+
+// ErrServiceNotFound is returned for services systemd has no unit for
+var ErrServiceNotFound = errors.New("service not found")
+
+// ReloadSystemdService asks a service to reload its configuration. With
+// orRestart set, services that can't reload are restarted instead.
+func ReloadSystemdService(scope ServiceScope, serviceName string, orRestart bool) error {
+	if err := validateServiceName(serviceName); err != nil {
+		return err
+	}
+	if orRestart {
+		return ControlSystemdService(scope, serviceName, "reload-or-restart")
+	}
+
+	output, err := runCommand("systemctl", scope.args("show", serviceName, "--property=LoadState,CanReload")...)
+	if err != nil {
+		return err
+	}
+	properties := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			properties[key] = strings.TrimSpace(value)
+		}
+	}
+	// Unknown units are reported with CanReload=no rather than an error
+	if properties["LoadState"] == "not-found" {
+		return fmt.Errorf("%w: %s", ErrServiceNotFound, serviceName)
+	}
+	if properties["CanReload"] != "yes" {
+		return fmt.Errorf("%w: %s", ErrReloadNotSupported, serviceName)
+	}
+	return ControlSystemdService(scope, serviceName, "reload")
+}
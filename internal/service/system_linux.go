@@ -0,0 +1,213 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"docker-manager/internal/models"
+)
+
+// readHostSystemInfo fills in hostInfo from /proc
+func readHostSystemInfo(ctx context.Context, hostInfo *models.HostSystemInfo) {
+	hostInfo.Supported = true
+
+	// Get uptime
+	if uptimeData, err := ioutil.ReadFile("/proc/uptime"); err == nil {
+		uptimeStr := strings.TrimSpace(string(uptimeData))
+		if uptimeParts := strings.Split(uptimeStr, " "); len(uptimeParts) > 0 {
+			if uptimeSeconds, err := strconv.ParseFloat(uptimeParts[0], 64); err == nil {
+				hostInfo.UptimeSeconds = int64(uptimeSeconds)
+				hostInfo.Uptime = formatUptime(int64(uptimeSeconds))
+			}
+		}
+	}
+
+	// Get load average
+	if loadData, err := ioutil.ReadFile("/proc/loadavg"); err == nil {
+		loadStr := strings.TrimSpace(string(loadData))
+		loadParts := strings.Split(loadStr, " ")
+		if len(loadParts) >= 3 {
+			if load1, err := strconv.ParseFloat(loadParts[0], 64); err == nil {
+				hostInfo.LoadAverage1 = load1
+			}
+			if load5, err := strconv.ParseFloat(loadParts[1], 64); err == nil {
+				hostInfo.LoadAverage5 = load5
+			}
+			if load15, err := strconv.ParseFloat(loadParts[2], 64); err == nil {
+				hostInfo.LoadAverage15 = load15
+			}
+		}
+	}
+
+	// Get memory info
+	if memData, err := ioutil.ReadFile("/proc/meminfo"); err == nil {
+		var swapFree int64
+		scanner := bufio.NewScanner(strings.NewReader(string(memData)))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "MemTotal:") {
+				if parts := strings.Fields(line); len(parts) >= 2 {
+					if total, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
+						hostInfo.MemoryTotal = total * 1024 // Convert from KB to bytes
+					}
+				}
+			} else if strings.HasPrefix(line, "MemAvailable:") {
+				if parts := strings.Fields(line); len(parts) >= 2 {
+					if available, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
+						hostInfo.MemoryAvailable = available * 1024 // Convert from KB to bytes
+					}
+				}
+			} else if strings.HasPrefix(line, "SwapTotal:") {
+				if parts := strings.Fields(line); len(parts) >= 2 {
+					if total, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
+						hostInfo.SwapTotal = total * 1024
+					}
+				}
+			} else if strings.HasPrefix(line, "SwapFree:") {
+				if parts := strings.Fields(line); len(parts) >= 2 {
+					if free, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
+						swapFree = free * 1024
+					}
+				}
+			}
+		}
+		hostInfo.MemoryUsed = hostInfo.MemoryTotal - hostInfo.MemoryAvailable
+		if hostInfo.MemoryTotal > 0 {
+			hostInfo.MemoryUsedPct = float64(hostInfo.MemoryUsed) / float64(hostInfo.MemoryTotal) * 100
+		}
+		hostInfo.SwapUsed = hostInfo.SwapTotal - swapFree
+		if hostInfo.SwapTotal > 0 {
+			hostInfo.SwapUsedPct = float64(hostInfo.SwapUsed) / float64(hostInfo.SwapTotal) * 100
+		}
+	}
+
+	// Get disk usage
+	hostInfo.Filesystems = hostFilesystems(recordedDisk.dockerRootDir(ctx))
+
+	// Get network connections (simplified)
+	if netData, err := ioutil.ReadFile("/proc/net/tcp"); err == nil {
+		lines := strings.Split(string(netData), "\n")
+		hostInfo.NetworkConnections = len(lines) - 2 // Subtract header and last empty line
+		if hostInfo.NetworkConnections < 0 {
+			hostInfo.NetworkConnections = 0
+		}
+	}
+}
+
+// pseudoFilesystems are filesystem types without disk space worth reporting.
+// overlay is listed for the root filesystems of containers on this host, but
+// / and the Docker data root are kept whatever their type, since / is often
+// overlay when the manager itself runs in a container.
+var pseudoFilesystems = map[string]bool{
+	"autofs": true, "binfmt_misc": true, "bpf": true, "cgroup": true, "cgroup2": true,
+	"configfs": true, "debugfs": true, "devpts": true, "devtmpfs": true, "efivarfs": true,
+	"fusectl": true, "hugetlbfs": true, "mqueue": true, "nsfs": true, "overlay": true,
+	"proc": true, "pstore": true, "ramfs": true, "rpc_pipefs": true, "securityfs": true,
+	"squashfs": true, "sysfs": true, "tmpfs": true, "tracefs": true,
+}
+
+// hostFilesystems returns the usage of every real filesystem in /proc/mounts,
+// each filesystem once under its shortest mountpoint. The filesystem holding
+// dockerRoot is marked when dockerRoot is set.
+func hostFilesystems(dockerRoot string) []models.FilesystemUsage {
+	filesystems := []models.FilesystemUsage{}
+
+	mounts, err := os.ReadFile("/proc/mounts")
+	if err != nil {
+		return filesystems
+	}
+
+	// Bind mounts show the same device again under other mountpoints
+	byDevice := make(map[string]models.FilesystemUsage)
+	for _, line := range strings.Split(string(mounts), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		mountpoint := unescapeMountPath(fields[1])
+		if pseudoFilesystems[fields[2]] && mountpoint != "/" && (dockerRoot == "" || mountpoint != dockerRoot) {
+			continue
+		}
+		if existing, ok := byDevice[fields[0]]; ok && len(existing.Mountpoint) <= len(mountpoint) {
+			continue
+		}
+		byDevice[fields[0]] = models.FilesystemUsage{Mountpoint: mountpoint, Device: fields[0], Type: fields[2]}
+	}
+
+	for _, usage := range byDevice {
+		total, available, err := filesystemUsage(usage.Mountpoint)
+		if err != nil || total == 0 {
+			continue
+		}
+		usage.Total = total
+		usage.Used = total - available
+		usage.Available = available
+		usage.UsedPct = float64(usage.Used) / float64(total) * 100
+		filesystems = append(filesystems, usage)
+	}
+
+	sort.Slice(filesystems, func(i, j int) bool {
+		return filesystems[i].Mountpoint < filesystems[j].Mountpoint
+	})
+	if dockerRoot != "" {
+		// The data root lives on the filesystem with the longest matching mountpoint
+		best := -1
+		for i, fs := range filesystems {
+			if pathWithin(dockerRoot, fs.Mountpoint) && (best < 0 || len(fs.Mountpoint) > len(filesystems[best].Mountpoint)) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			filesystems[best].DockerDataRoot = true
+		}
+	}
+	return filesystems
+}
+
+// unescapeMountPath decodes the octal escapes /proc/mounts uses for spaces,
+// tabs, newlines and backslashes in paths
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, "\\") {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if code, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(code))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// pathWithin reports whether path is mountpoint or below it
+func pathWithin(path, mountpoint string) bool {
+	if mountpoint == "/" {
+		return strings.HasPrefix(path, "/")
+	}
+	return path == mountpoint || strings.HasPrefix(path, mountpoint+"/")
+}
+
+func formatUptime(seconds int64) string {
+	days := seconds / 86400
+	hours := (seconds % 86400) / 3600
+	minutes := (seconds % 3600) / 60
+
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	} else if hours > 0 {
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	} else {
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package service
+
+import (
+	"context"
+
+	"docker-manager/internal/models"
+)
+
+// readHostSystemInfo only reports the root filesystem, the rest of the host
+// information is read from /proc which only exists on Linux
+func readHostSystemInfo(ctx context.Context, hostInfo *models.HostSystemInfo) {
+	if total, available, err := filesystemUsage("/"); err == nil && total > 0 {
+		usage := models.FilesystemUsage{
+			Mountpoint: "/",
+			Total:      total,
+			Used:       total - available,
+			Available:  available,
+		}
+		usage.UsedPct = float64(usage.Used) / float64(total) * 100
+		hostInfo.Filesystems = append(hostInfo.Filesystems, usage)
+	}
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"docker-manager/internal/models"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/versions"
+)
+
+// BackupContainerVolume writes a tar archive of the volume mounted at
+// destination inside a container. The archive API works on stopped
+// containers, so the volume can be backed up while nothing writes to it.
+func BackupContainerVolume(ctx context.Context, containerID, destination string, w io.Writer) (int64, error) {
+	reader, _, err := DockerClient(ctx).CopyFromContainer(ctx, containerID, destination)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	return io.Copy(w, reader)
+}
+
+// ExportContainer opens a tar stream of a container's filesystem, like
+// `docker export`, and returns it with the container's name. The caller must
+// close the stream.
+func ExportContainer(ctx context.Context, containerID string) (string, io.ReadCloser, error) {
+	containerJSON, err := DockerClient(ctx).ContainerInspect(ctx, containerID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	reader, err := DockerClient(ctx).ContainerExport(ctx, containerID)
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.TrimPrefix(containerJSON.Name, "/"), reader, nil
+}
+
+// SnapshotContainer stops a container, writes a zip archive holding a tar of
+// each of its named volumes to w and starts the container again. The container
+// is restarted even when a backup fails; per-volume results are recorded in a
+// snapshot.json manifest at the end of the archive. A returned error means
+// nothing has been written to w.
+func SnapshotContainer(ctx context.Context, containerID string, w io.Writer) (*models.ContainerSnapshot, error) {
+	containerJSON, err := DockerClient(ctx).ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &models.ContainerSnapshot{
+		Container: strings.TrimPrefix(containerJSON.Name, "/"),
+		CreatedAt: time.Now().UTC(),
+		Volumes:   []models.VolumeBackupResult{},
+	}
+
+	wasRunning := containerJSON.State != nil && containerJSON.State.Running
+	if wasRunning {
+		if err := StopContainer(ctx, containerID, nil); err != nil {
+			return nil, err
+		}
+		snapshot.Stopped = true
+	}
+
+	archive := zip.NewWriter(w)
+	for _, m := range containerJSON.Mounts {
+		if m.Type != mount.TypeVolume {
+			continue
+		}
+
+		result := models.VolumeBackupResult{
+			Volume:      m.Name,
+			Destination: m.Destination,
+			File:        m.Name + ".tar",
+		}
+		entry, err := archive.Create(result.File)
+		if err == nil {
+			result.Bytes, err = BackupContainerVolume(ctx, containerID, m.Destination, entry)
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		snapshot.Volumes = append(snapshot.Volumes, result)
+	}
+
+	if wasRunning {
+		defer invalidateContainerCaches()
+		// Restart even if the client has gone away, the container must not
+		// be left stopped
+		startCtx, cancel := WithTimeout(context.WithoutCancel(ctx))
+		defer cancel()
+		if err := DockerClient(startCtx).ContainerStart(startCtx, containerID, types.ContainerStartOptions{}); err != nil {
+			snapshot.RestartError = err.Error()
+		} else {
+			snapshot.Restarted = true
+		}
+	}
+
+	if entry, err := archive.Create("snapshot.json"); err == nil {
+		encoder := json.NewEncoder(entry)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(snapshot)
+	}
+	archive.Close()
+
+	return snapshot, nil
+}
+
+// anonymousVolumeLabel marks the volumes Docker created for a container
+// without a name. Since API 1.42 only these are pruned.
+const anonymousVolumeLabel = "com.docker.volume.anonymous"
+
+// PruneVolumes removes the unused volumes, limited to those carrying label
+// when it is set. Recent daemons only prune anonymous volumes. With dryRun
+// set the volumes that would be removed are reported instead.
+func PruneVolumes(ctx context.Context, label string, dryRun bool) (*models.VolumePruneResult, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	if dryRun {
+		return previewVolumePrune(ctx, label)
+	}
+
+	args := filters.NewArgs()
+	if label != "" {
+		args.Add("label", label)
+	}
+	report, err := DockerClient(ctx).VolumesPrune(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.VolumePruneResult{
+		VolumesDeleted: report.VolumesDeleted,
+		SpaceReclaimed: report.SpaceReclaimed,
+	}
+	if result.VolumesDeleted == nil {
+		result.VolumesDeleted = []string{}
+	}
+	return result, nil
+}
+
+// previewVolumePrune lists the volumes PruneVolumes would remove with the
+// space they take up
+func previewVolumePrune(ctx context.Context, label string) (*models.VolumePruneResult, error) {
+	usage, err := DockerClient(ctx).DiskUsage(ctx, types.DiskUsageOptions{
+		Types: []types.DiskUsageObject{types.VolumeObject},
+	})
+	if err != nil {
+		return nil, err
+	}
+	anonymousOnly := versions.GreaterThanOrEqualTo(DockerClient(ctx).ClientVersion(), "1.42")
+	labelKey, labelValue, hasValue := strings.Cut(label, "=")
+
+	result := &models.VolumePruneResult{VolumesDeleted: []string{}}
+	for _, volume := range usage.Volumes {
+		if volume.UsageData == nil || volume.UsageData.RefCount != 0 {
+			continue
+		}
+		if _, ok := volume.Labels[anonymousVolumeLabel]; anonymousOnly && !ok {
+			continue
+		}
+		if value, ok := volume.Labels[labelKey]; label != "" && (!ok || hasValue && value != labelValue) {
+			continue
+		}
+		result.VolumesDeleted = append(result.VolumesDeleted, volume.Name)
+		if volume.UsageData.Size > 0 {
+			result.SpaceReclaimed += uint64(volume.UsageData.Size)
+		}
+	}
+	sort.Strings(result.VolumesDeleted)
+	return result, nil
+}
+
+// GetBindMounts returns every host path bind-mounted into a container,
+// running or not, with the containers that mount it
+func GetBindMounts(ctx context.Context) ([]models.HostBindMount, error) {
+	ctx, cancel := WithTimeout(ctx)
+	defer cancel()
+	containers, err := cachedContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+
+	byPath := make(map[string]*models.HostBindMount)
+	for _, c := range containers {
+		for _, m := range c.Mounts {
+			if m.Type != mount.TypeBind {
+				continue
+			}
+
+			hostMount, ok := byPath[m.Source]
+			if !ok {
+				hostMount = &models.HostBindMount{HostPath: m.Source}
+				byPath[m.Source] = hostMount
+			}
+			hostMount.Containers = append(hostMount.Containers, models.BindMountUse{
+				ContainerID:   c.ID,
+				ContainerName: containerName(c),
+				Destination:   m.Destination,
+				ReadOnly:      !m.RW,
+			})
+		}
+	}
+
+	result := make([]models.HostBindMount, 0, len(byPath))
+	for _, hostMount := range byPath {
+		result = append(result, *hostMount)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].HostPath < result[j].HostPath
+	})
+
+	return result, nil
+}
@@ -0,0 +1,12 @@
+// Package version holds build information about docker-manager, set at
+// build time with -ldflags "-X docker-manager/internal/version.Version=..."
+package version
+
+var (
+	// Version is the release of docker-manager
+	Version = "dev"
+	// Commit is the git commit the binary was built from
+	Commit = "unknown"
+	// BuildDate is when the binary was built
+	BuildDate = "unknown"
+)
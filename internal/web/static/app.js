@@ -74,8 +74,12 @@ class DockerManager {
             };
 
             this.ws.onmessage = (event) => {
-                const eventData = JSON.parse(event.data);
-                this.handleDockerEvent(eventData);
+                const message = JSON.parse(event.data);
+                if (message.type === 'event') {
+                    this.handleDockerEvent(message.data);
+                } else if (message.type === 'stats' && this.currentTab === 'dashboard') {
+                    this.updateDashboardStats(message.data);
+                }
             };
 
             this.ws.onclose = () => {
@@ -401,6 +405,16 @@ class DockerManager {
     }
 
     updateHostSystemInfo(hostInfo) {
+        // Only the CPU cores are known outside Linux, don't show zeros
+        if (hostInfo.supported === false) {
+            const unsupported = `Not available on ${hostInfo.platform}`;
+            ['host-uptime', 'host-load', 'host-memory', 'host-swap', 'host-connections'].forEach(id => {
+                document.getElementById(id).textContent = unsupported;
+            });
+            document.getElementById('host-cpu-cores').textContent = hostInfo.cpu_cores || 'N/A';
+            return;
+        }
+
         document.getElementById('host-uptime').textContent = hostInfo.uptime || 'N/A';
 
         const loadText = `${hostInfo.load_avg_1?.toFixed(2) || 'N/A'} / ${hostInfo.load_avg_5?.toFixed(2) || 'N/A'} / ${hostInfo.load_avg_15?.toFixed(2) || 'N/A'}`;
@@ -411,6 +425,11 @@ class DockerManager {
         const memoryText = `${memoryUsedGB} GB / ${memoryTotalGB} GB (${hostInfo.memory_used_percent?.toFixed(1) || 'N/A'}%)`;
         document.getElementById('host-memory').textContent = memoryText;
 
+        const swapText = hostInfo.swap_total > 0
+            ? `${this.formatBytes(hostInfo.swap_used)} / ${this.formatBytes(hostInfo.swap_total)} (${hostInfo.swap_used_percent.toFixed(1)}%)`
+            : 'No swap';
+        document.getElementById('host-swap').textContent = swapText;
+
         document.getElementById('host-connections').textContent = hostInfo.network_connections || 'N/A';
         document.getElementById('host-cpu-cores').textContent = hostInfo.cpu_cores || 'N/A';
     }